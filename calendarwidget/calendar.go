@@ -3,7 +3,6 @@ package calendar
 import (
 	"bot/telegram"
 	"fmt"
-	"strconv"
 	"time"
 )
 
@@ -17,6 +16,9 @@ func NewCalendar(opt Options) *Calendar {
 	if opt.InitialMonth == 0 {
 		opt.InitialMonth = time.Now().Month()
 	}
+	if opt.Purpose == "" {
+		opt.Purpose = DefaultPurpose
+	}
 	if err := opt.validate(); err != nil {
 		panic(err)
 	}
@@ -57,6 +59,27 @@ type Options struct {
 	// If equals "ru" the designations would be Russian,
 	// otherwise - English
 	Language string
+
+	// Days before MinDate are disabled, the calendar doesn't swipe
+	// to earlier months. Only the date part is used.
+	// Default value - zero (no limit)
+	MinDate time.Time
+
+	// Days after MaxDate are disabled, the calendar doesn't swipe
+	// to later months. Only the date part is used.
+	// Default value - zero (no limit)
+	MaxDate time.Time
+
+	// Returns the state, label and marker of a day (the date is passed in UTC).
+	// Called for every day of the displayed month within [MinDate, MaxDate].
+	// Default value - nil (all days are available)
+	DayInfo func(day time.Time) DayInfo
+
+	// The tag embedded in the callback data of every button
+	// (see ParseCallback), e.g. to tell a booking calendar from a report one.
+	// Lowercase latin letters, digits and "_", up to 16 characters.
+	// Default value - "main"
+	Purpose string
 }
 
 // GetKeyboard builds the calendar inline-keyboard
@@ -83,15 +106,15 @@ func (cal *Calendar) addMonthYearRow() {
 
 	btn := telegram.InlineKeyboardButton{
 		Text:         fmt.Sprintf("%s %v", cal.getMonthDisplayName(cal.currMonth), cal.currYear),
-		CallbackData: "cal:view:months", // нажали — показать выбор месяца
+		CallbackData: cal.callbackData(ActionMonths), // нажали — показать выбор месяца
 	}
 
 	row = append(row, btn)
 	cal.addRowToKeyboard(&row)
 }
 
-// Builds a keyboard with a list of months to pick
-func (cal *Calendar) getMonthPickKeyboard() [][]telegram.InlineKeyboardButton {
+// GetMonthPickKeyboard builds a keyboard with a list of months to pick
+func (cal *Calendar) GetMonthPickKeyboard() [][]telegram.InlineKeyboardButton {
 	cal.clearKeyboard()
 
 	var row []telegram.InlineKeyboardButton
@@ -102,7 +125,12 @@ func (cal *Calendar) getMonthPickKeyboard() [][]telegram.InlineKeyboardButton {
 
 		monthBtn := telegram.InlineKeyboardButton{
 			Text:         monthName,
-			CallbackData: "cal:month:" + strconv.Itoa(i),
+			CallbackData: cal.callbackData(ActionMonth, i),
+		}
+		// месяц целиком вне MinDate/MaxDate — выбрать нельзя
+		if !cal.monthInRange(cal.currYear, time.Month(i)) {
+			monthBtn.Text = crossOut(monthName)
+			monthBtn.CallbackData = noopCallbackData()
 		}
 
 		row = append(row, monthBtn)
@@ -130,7 +158,7 @@ func (cal *Calendar) addWeekdaysRow() {
 	for _, wd := range cal.getWeekdaysDisplayArray() {
 		btn := telegram.InlineKeyboardButton{
 			Text:         wd,
-			CallbackData: "cal:noop",
+			CallbackData: noopCallbackData(),
 		}
 		row = append(row, btn)
 	}
@@ -163,11 +191,15 @@ func (cal *Calendar) addDaysRows() {
 
 	// Кнопки дней
 	for i := 1; i <= amountOfDaysInMonth; i++ {
-		dayText := strconv.Itoa(i)
+		info := cal.dayInfo(i)
 
 		cell := telegram.InlineKeyboardButton{
-			Text:         dayText,
-			CallbackData: "cal:day:" + dayText, // ✅ при нажатии придёт callback_query.data
+			Text:         info.text(i),
+			CallbackData: cal.callbackData(ActionDay, i), // ✅ при нажатии придёт callback_query.data
+		}
+		// недоступный день не нажимается
+		if !info.clickable() {
+			cell.CallbackData = noopCallbackData()
 		}
 
 		row = append(row, cell)
@@ -194,24 +226,28 @@ func (cal *Calendar) addControlButtonsRow() {
 
 	prev := telegram.InlineKeyboardButton{
 		Text:         "＜",
-		CallbackData: "cal:nav:prev",
+		CallbackData: cal.callbackData(ActionPrev),
 	}
 
 	// Hide "prev" button if it rests on the range
-	if cal.currYear <= cal.opt.YearRange[0] && cal.currMonth == 1 {
+	prevMonth := time.Date(cal.currYear, cal.currMonth-1, 1, 0, 0, 0, 0, time.UTC)
+	if cal.currYear <= cal.opt.YearRange[0] && cal.currMonth == 1 ||
+		!cal.monthInRange(prevMonth.Year(), prevMonth.Month()) {
 		prev.Text = " "
-		prev.CallbackData = "cal:noop"
+		prev.CallbackData = noopCallbackData()
 	}
 
 	next := telegram.InlineKeyboardButton{
 		Text:         "＞",
-		CallbackData: "cal:nav:next",
+		CallbackData: cal.callbackData(ActionNext),
 	}
 
 	// Hide "next" button if it rests on the range
-	if cal.currYear >= cal.opt.YearRange[1] && cal.currMonth == 12 {
+	nextMonth := time.Date(cal.currYear, cal.currMonth+1, 1, 0, 0, 0, 0, time.UTC)
+	if cal.currYear >= cal.opt.YearRange[1] && cal.currMonth == 12 ||
+		!cal.monthInRange(nextMonth.Year(), nextMonth.Month()) {
 		next.Text = " "
-		next.CallbackData = "cal:noop"
+		next.CallbackData = noopCallbackData()
 	}
 
 	row = append(row, prev, next)
@@ -233,6 +269,6 @@ func (cal *Calendar) addRowToKeyboard(row *[]telegram.InlineKeyboardButton) {
 func (cal *Calendar) addEmptyCell(row *[]telegram.InlineKeyboardButton) {
 	*row = append(*row, telegram.InlineKeyboardButton{
 		Text:         " ",
-		CallbackData: "cal:noop",
+		CallbackData: noopCallbackData(),
 	})
 }
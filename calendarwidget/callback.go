@@ -0,0 +1,168 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Callback data of the calendar buttons:
+//
+//	cal:<purpose>:<YYYYMM>:<action>[:<arg>]
+//	cal:noop
+//
+// The displayed year and month travel with every button, so a calendar
+// message stays usable without any server-side state
+const CallbackPrefix = "cal:"
+
+// DefaultPurpose is used when Options.Purpose is empty
+const DefaultPurpose = "main"
+
+// ErrInvalidCallback is returned by ParseCallback for malformed data
+var ErrInvalidCallback = errors.New("invalid calendar callback data")
+
+var purposeRegexp = regexp.MustCompile(`^[a-z0-9_]{1,16}$`)
+
+// Action is what the pressed button asks for
+type Action string
+
+const (
+	// ActionNoop - a decorative or disabled button
+	ActionNoop Action = "noop"
+
+	// ActionDay - a day is picked (Callback.Day)
+	ActionDay Action = "day"
+
+	// ActionPrev / ActionNext - swipe to the previous / next month
+	ActionPrev Action = "prev"
+	ActionNext Action = "next"
+
+	// ActionMonths - show the month picker
+	ActionMonths Action = "months"
+
+	// ActionMonth - a month is picked in the month picker (Callback.PickedMonth)
+	ActionMonth Action = "month"
+)
+
+// Callback is the parsed data of a calendar button
+type Callback struct {
+	// Options.Purpose of the calendar the button belongs to
+	Purpose string
+
+	// The month displayed when the button was rendered
+	Year  int
+	Month time.Month
+
+	Action Action
+
+	// Set for ActionDay
+	Day int
+
+	// Set for ActionMonth
+	PickedMonth time.Month
+}
+
+// IsCallback reports whether the data belongs to a calendar button
+func IsCallback(data string) bool {
+	return strings.HasPrefix(data, CallbackPrefix)
+}
+
+// ParseCallback parses the data of a calendar button
+func ParseCallback(data string) (Callback, error) {
+	if data == CallbackPrefix+string(ActionNoop) {
+		return Callback{Action: ActionNoop}, nil
+	}
+	if !IsCallback(data) {
+		return Callback{}, ErrInvalidCallback
+	}
+
+	parts := strings.Split(strings.TrimPrefix(data, CallbackPrefix), ":")
+	if len(parts) < 3 || !purposeRegexp.MatchString(parts[0]) {
+		return Callback{}, ErrInvalidCallback
+	}
+	ym, err := time.Parse("200601", parts[1])
+	if err != nil || ym.Year() < MinYearLimit {
+		return Callback{}, ErrInvalidCallback
+	}
+
+	cb := Callback{
+		Purpose: parts[0],
+		Year:    ym.Year(),
+		Month:   ym.Month(),
+		Action:  Action(parts[2]),
+	}
+	args := parts[3:]
+
+	switch cb.Action {
+	case ActionPrev, ActionNext, ActionMonths:
+		if len(args) != 0 {
+			return Callback{}, ErrInvalidCallback
+		}
+	case ActionDay:
+		if len(args) != 1 {
+			return Callback{}, ErrInvalidCallback
+		}
+		day, err := strconv.Atoi(args[0])
+		if err != nil || day < 1 || day > daysIn(cb.Year, cb.Month) {
+			return Callback{}, ErrInvalidCallback
+		}
+		cb.Day = day
+	case ActionMonth:
+		if len(args) != 1 {
+			return Callback{}, ErrInvalidCallback
+		}
+		month, err := strconv.Atoi(args[0])
+		if err != nil || month < 1 || month > 12 {
+			return Callback{}, ErrInvalidCallback
+		}
+		cb.PickedMonth = time.Month(month)
+	default:
+		return Callback{}, ErrInvalidCallback
+	}
+	return cb, nil
+}
+
+// Date returns the picked day (UTC midnight) for ActionDay
+func (cb Callback) Date() time.Time {
+	return time.Date(cb.Year, cb.Month, cb.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// Target returns the month to display after the action:
+// the adjacent one for ActionPrev/ActionNext, the picked one for ActionMonth
+// and the same one otherwise
+func (cb Callback) Target() (int, time.Month) {
+	var t time.Time
+	switch cb.Action {
+	case ActionPrev:
+		t = time.Date(cb.Year, cb.Month-1, 1, 0, 0, 0, 0, time.UTC)
+	case ActionNext:
+		t = time.Date(cb.Year, cb.Month+1, 1, 0, 0, 0, 0, time.UTC)
+	case ActionMonth:
+		t = time.Date(cb.Year, cb.PickedMonth, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		t = time.Date(cb.Year, cb.Month, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t.Year(), t.Month()
+}
+
+// callbackData builds the data of a button of the displayed month
+func (cal *Calendar) callbackData(action Action, arg ...int) string {
+	data := fmt.Sprintf("%s%s:%04d%02d:%s", CallbackPrefix, cal.opt.Purpose, cal.currYear, int(cal.currMonth), action)
+	for _, a := range arg {
+		data += ":" + strconv.Itoa(a)
+	}
+	return data
+}
+
+// noopCallbackData - the data of a button that does nothing
+func noopCallbackData() string {
+	return CallbackPrefix + string(ActionNoop)
+}
+
+// daysIn returns the number of days in the month
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,144 @@
+package calendar
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DayState describes whether a day can be picked and how it is marked
+type DayState int
+
+const (
+	// DayAvailable - a regular clickable day
+	DayAvailable DayState = iota
+
+	// DayDisabled - can't be picked (past, out of range, day off).
+	// Rendered crossed out and not clickable
+	DayDisabled
+
+	// DayFullyBooked - there is no free time left.
+	// Rendered crossed out with a marker and not clickable
+	DayFullyBooked
+
+	// DayHasAppointments - clickable, marked with a dot (or DayInfo.Marker)
+	DayHasAppointments
+
+	// DayHoliday - a holiday or a special day off. Not clickable
+	DayHoliday
+
+	// DayBlocked - the day is blocked out (vacation, time off).
+	// Rendered crossed out with a marker and not clickable
+	DayBlocked
+)
+
+// Default markers appended to the day number
+const (
+	FullyBookedMarker     = "✖"
+	HasAppointmentsMarker = "•"
+	HolidayMarker         = "🎉"
+	BlockedMarker         = "⛔"
+)
+
+// DayInfo is returned by Options.DayInfo for every day of the displayed month
+type DayInfo struct {
+	State DayState
+
+	// Replaces the day number if not empty
+	Label string
+
+	// Appended to the day number instead of the default marker of the State,
+	// e.g. the number of lessons
+	Marker string
+}
+
+// clickable reports whether the day cell sends ActionDay
+func (d DayInfo) clickable() bool {
+	return d.State == DayAvailable || d.State == DayHasAppointments
+}
+
+// text builds the cell text
+func (d DayInfo) text(day int) string {
+	if d.Label != "" {
+		return d.Label
+	}
+
+	num := strconv.Itoa(day)
+	marker := d.Marker
+	switch d.State {
+	case DayDisabled:
+		return crossOut(num) + marker
+	case DayFullyBooked:
+		if marker == "" {
+			marker = FullyBookedMarker
+		}
+		return crossOut(num) + marker
+	case DayBlocked:
+		if marker == "" {
+			marker = BlockedMarker
+		}
+		return crossOut(num) + marker
+	case DayHasAppointments:
+		if marker == "" {
+			marker = HasAppointmentsMarker
+		}
+	case DayHoliday:
+		if marker == "" {
+			marker = HolidayMarker
+		}
+	}
+	return num + marker
+}
+
+// crossOut strikes the text through with combining characters
+// (inline buttons don't support formatting)
+func crossOut(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteRune(r)
+		b.WriteRune('̶')
+	}
+	return b.String()
+}
+
+// dayInfo returns the state of the day of the displayed month,
+// taking MinDate/MaxDate into account
+func (cal *Calendar) dayInfo(day int) DayInfo {
+	date := time.Date(cal.currYear, cal.currMonth, day, 0, 0, 0, 0, time.UTC)
+	if !cal.inRange(date) {
+		return DayInfo{State: DayDisabled}
+	}
+	if cal.opt.DayInfo == nil {
+		return DayInfo{}
+	}
+	return cal.opt.DayInfo(date)
+}
+
+// inRange - the date is within [MinDate, MaxDate] (only the date part counts)
+func (cal *Calendar) inRange(date time.Time) bool {
+	if !cal.opt.MinDate.IsZero() && date.Before(dateOnly(cal.opt.MinDate)) {
+		return false
+	}
+	if !cal.opt.MaxDate.IsZero() && date.After(dateOnly(cal.opt.MaxDate)) {
+		return false
+	}
+	return true
+}
+
+// monthInRange - at least one day of the month is within [MinDate, MaxDate]
+func (cal *Calendar) monthInRange(year int, month time.Month) bool {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1)
+	if !cal.opt.MinDate.IsZero() && last.Before(dateOnly(cal.opt.MinDate)) {
+		return false
+	}
+	if !cal.opt.MaxDate.IsZero() && first.After(dateOnly(cal.opt.MaxDate)) {
+		return false
+	}
+	return true
+}
+
+// dateOnly drops the time and the location: the calendar works with dates
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -2,4 +2,5 @@ package calendar
 
 var (
 	errYearRangeValue = "Option.YearRange exceeds the acceptable limits of time.Unix"
+	errDateRangeValue = "Option.MaxDate is before Option.MinDate"
 )
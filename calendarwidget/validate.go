@@ -2,6 +2,7 @@ package calendar
 
 import (
 	"errors"
+	"time"
 
 	vd "github.com/go-ozzo/ozzo-validation"
 )
@@ -20,5 +21,13 @@ func (opt *Options) validate() error {
 			vd.Max(opt.YearRange[1]),
 		),
 		vd.Field(&opt.InitialMonth, vd.Required, vd.Min(1), vd.Max(12)),
+		vd.Field(&opt.Purpose, vd.Required, vd.Match(purposeRegexp)),
+		vd.Field(&opt.MaxDate, vd.By(func(v interface{}) error {
+			maxDate := v.(time.Time)
+			if !opt.MinDate.IsZero() && !maxDate.IsZero() && dateOnly(maxDate).Before(dateOnly(opt.MinDate)) {
+				return errors.New(errDateRangeValue)
+			}
+			return nil
+		})),
 	)
 }
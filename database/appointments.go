@@ -7,80 +7,80 @@ import (
 	"time"
 )
 
-var ErrSlotBusy = errors.New("slot busy")
+var (
+	ErrSlotBusy           = errors.New("slot busy")
+	ErrAppointmentChanged = errors.New("appointment changed")
+)
 
 type Appointment struct {
 	ID            int64
+	TeacherID     int64
 	StudentChatID int64
 	StudentName   string
 	StartTS       int64
 	EndTS         int64
 	DurationMin   int
 	CreatedTS     int64
+	SeriesID      int64 // 0 — разовая запись
 }
 
-// GetAppointmentsByDay возвращает все записи на конкретный день (по локальному времени)
-func GetAppointmentsByDay(db *sql.DB, dayStartTS int64, dayEndTS int64) ([]Appointment, error) {
-	rows, err := db.Query(`
-		SELECT id, student_chat_id, student_name, start_ts, end_ts, duration_min, created_ts
-		FROM appointments
-		WHERE start_ts >= ? AND start_ts < ?
-		ORDER BY start_ts
-	`, dayStartTS, dayEndTS)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+const appointmentColumns = `id, teacher_id, student_chat_id, student_name, start_ts, end_ts, duration_min, created_ts, series_id`
 
+func scanAppointments(rows *sql.Rows) ([]Appointment, error) {
 	var res []Appointment
 	for rows.Next() {
 		var a Appointment
 		if err := rows.Scan(
 			&a.ID,
+			&a.TeacherID,
 			&a.StudentChatID,
 			&a.StudentName,
 			&a.StartTS,
 			&a.EndTS,
 			&a.DurationMin,
 			&a.CreatedTS,
+			&a.SeriesID,
 		); err != nil {
 			return nil, err
 		}
 		res = append(res, a)
 	}
-	return res, nil
+	return res, rows.Err()
 }
 
-// DeleteAppointmentByIDTeacher удаляет запись по id (для преподавателя — без проверки владельца)
-func DeleteAppointmentByIDTeacher(db *sql.DB, id int64) error {
-	res, err := db.Exec(`
-		DELETE FROM appointments
-		WHERE id = ?
-	`, id)
-	if err != nil {
-		return err
-	}
-	n, err := res.RowsAffected()
+// NewAppointment — что нужно, чтобы создать запись
+type NewAppointment struct {
+	TeacherID     int64
+	StudentChatID int64
+	StudentName   string
+	StartTS       int64
+	DurationMin   int
+	SeriesID      int64 // 0 — разовая запись
+}
+
+// GetAppointmentsByDay возвращает записи к преподавателю на конкретный день (по локальному времени)
+func GetAppointmentsByDay(db *sql.DB, teacherID int64, dayStartTS int64, dayEndTS int64) ([]Appointment, error) {
+	rows, err := db.Query(`
+		SELECT `+appointmentColumns+`
+		FROM appointments
+		WHERE teacher_id = ? AND start_ts >= ? AND start_ts < ?
+		ORDER BY start_ts
+	`, teacherID, dayStartTS, dayEndTS)
 	if err != nil {
-		return err
-	}
-	if n == 0 {
-		return errors.New("appointment not found")
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+	return scanAppointments(rows)
 }
 
 // CreateAppointmentTx атомарно:
 // 1) блокирует запись (BEGIN IMMEDIATE)
-// 2) проверяет пересечение интервалов
-// 3) вставляет запись если свободно
-func CreateAppointmentTx(db *sql.DB, studentChatID int64, studentName string, startTS int64, durationMin int) (int64, error) {
-	if durationMin != 60 && durationMin != 90 {
-		return 0, errors.New("invalid duration")
-	}
-	endTS := startTS + int64(durationMin)*60
-	createdTS := time.Now().Unix()
-
+// 2) проверяет рабочее время преподавателя (ErrOutsideWorkingHours)
+// 3) проверяет пересечение с его отпуском/перерывами (ErrBlockedPeriod), с его же записями
+// и с бронью листа ожидания за другим учеником (ErrSlotBusy) — к разным преподавателям
+// можно записаться на одно время
+// 4) вставляет запись если свободно
+func CreateAppointmentTx(db *sql.DB, na NewAppointment) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -96,26 +96,42 @@ func CreateAppointmentTx(db *sql.DB, studentChatID int64, studentName string, st
 	//	return 0, err
 	//}
 
-	// ✅ Проверяем пересечение интервалов
-	var cnt int
-	err = tx.QueryRowContext(ctx, `
-		SELECT COUNT(1)
-		FROM appointments
-		WHERE start_ts < ? AND end_ts > ?;
-	`, endTS, startTS).Scan(&cnt)
+	id, err := insertAppointmentTx(ctx, tx, na)
 	if err != nil {
 		return 0, err
 	}
 
-	if cnt > 0 {
-		return 0, ErrSlotBusy
+	// ✅ Фиксируем
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// insertAppointmentTx проверяет рабочее время и пересечения и вставляет запись с напоминаниями.
+// ErrSlotBusy / ErrOutsideWorkingHours / ErrBlockedPeriod возвращаются до любых изменений в tx.
+func insertAppointmentTx(ctx context.Context, tx *sql.Tx, na NewAppointment) (int64, error) {
+	if na.DurationMin != 60 && na.DurationMin != 90 {
+		return 0, errors.New("invalid duration")
+	}
+	endTS := na.StartTS + int64(na.DurationMin)*60
+	createdTS := time.Now().Unix()
+
+	// ✅ Проверяем рабочее время
+	if err := checkWorkingHoursTx(ctx, tx, na.TeacherID, na.StartTS, na.DurationMin); err != nil {
+		return 0, err
+	}
+
+	// ✅ Проверяем пересечение интервалов
+	if err := checkSlotFreeTx(ctx, tx, na.TeacherID, na.StudentChatID, na.StartTS, endTS, 0); err != nil {
+		return 0, err
 	}
 
 	// ✅ Вставляем запись
 	res, err := tx.ExecContext(ctx, `
-		INSERT INTO appointments (student_chat_id, student_name, start_ts, end_ts, duration_min, created_ts)
-		VALUES (?, ?, ?, ?, ?, ?);
-	`, studentChatID, studentName, startTS, endTS, durationMin, createdTS)
+		INSERT INTO appointments (teacher_id, student_chat_id, student_name, start_ts, end_ts, duration_min, created_ts, series_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`, na.TeacherID, na.StudentChatID, na.StudentName, na.StartTS, endTS, na.DurationMin, createdTS, na.SeriesID)
 	if err != nil {
 		return 0, err
 	}
@@ -125,8 +141,8 @@ func CreateAppointmentTx(db *sql.DB, studentChatID int64, studentName string, st
 		return 0, err
 	}
 
-	// ✅ Фиксируем
-	if err := tx.Commit(); err != nil {
+	// ✅ Ставим напоминания в той же транзакции
+	if err := enqueueRemindersTx(ctx, tx, id, na.StudentChatID, na.StartTS); err != nil {
 		return 0, err
 	}
 	return id, nil
@@ -135,7 +151,7 @@ func CreateAppointmentTx(db *sql.DB, studentChatID int64, studentName string, st
 // GetFutureAppointments возвращает будущие записи ученика (для выбора отмены)
 func GetFutureAppointments(db *sql.DB, chatID int64) ([]Appointment, error) {
 	rows, err := db.Query(`
-		SELECT id, student_chat_id, student_name, start_ts, end_ts, duration_min, created_ts
+		SELECT `+appointmentColumns+`
 		FROM appointments
 		WHERE student_chat_id = ?
 		  AND start_ts > ?
@@ -145,42 +161,98 @@ func GetFutureAppointments(db *sql.DB, chatID int64) ([]Appointment, error) {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanAppointments(rows)
+}
 
-	var res []Appointment
-	for rows.Next() {
-		var a Appointment
-		if err := rows.Scan(
-			&a.ID,
-			&a.StudentChatID,
-			&a.StudentName,
-			&a.StartTS,
-			&a.EndTS,
-			&a.DurationMin,
-			&a.CreatedTS,
-		); err != nil {
-			return nil, err
-		}
-		res = append(res, a)
+// checkSlotFreeTx — ErrBlockedPeriod, если [startTS, endTS) задевает недоступность преподавателя,
+// ErrSlotBusy — если пересекается с его записями или с временем, которое сейчас держится
+// за другим учеником из листа ожидания (studentChatID — для кого запись).
+// Запись exceptID (ту, что переносят) не учитывается; 0 — учитываются все.
+func checkSlotFreeTx(ctx context.Context, tx *sql.Tx, teacherID int64, studentChatID int64, startTS int64, endTS int64, exceptID int64) error {
+	if err := checkBlockedTx(ctx, tx, teacherID, startTS, endTS); err != nil {
+		return err
+	}
+	if err := checkWaitlistOffersTx(ctx, tx, teacherID, studentChatID, startTS, endTS); err != nil {
+		return err
 	}
-	return res, nil
-}
 
-// DeleteAppointmentByID удаляет запись по id, но только если она принадлежит этому ученику
-func DeleteAppointmentByID(db *sql.DB, id int64, chatID int64) error {
-	res, err := db.Exec(`
-		DELETE FROM appointments
-		WHERE id = ? AND student_chat_id = ?
-	`, id, chatID)
+	var cnt int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(1)
+		FROM appointments
+		WHERE teacher_id = ? AND start_ts < ? AND end_ts > ? AND id != ?;
+	`, teacherID, endTS, startTS, exceptID).Scan(&cnt)
 	if err != nil {
 		return err
 	}
+	if cnt > 0 {
+		return ErrSlotBusy
+	}
+	return nil
+}
+
+// GetAppointment возвращает запись по id
+func GetAppointment(db *sql.DB, id int64) (Appointment, bool, error) {
+	rows, err := db.Query(`SELECT `+appointmentColumns+` FROM appointments WHERE id = ?`, id)
+	if err != nil {
+		return Appointment{}, false, err
+	}
+	defer rows.Close()
+	apps, err := scanAppointments(rows)
+	if err != nil || len(apps) == 0 {
+		return Appointment{}, false, err
+	}
+	return apps[0], true, nil
+}
+
+// RescheduleAppointmentTx атомарно переносит запись a на newStartTS (длительность та же):
+// проверяет рабочее время и пересечения (кроме самой записи), меняет время и заново ставит
+// напоминания. Если запись успели отменить или перенести — ErrAppointmentChanged.
+func RescheduleAppointmentTx(db *sql.DB, a Appointment, newStartTS int64) (Appointment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return Appointment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
 
+	newEndTS := newStartTS + int64(a.DurationMin)*60
+	if err := checkWorkingHoursTx(ctx, tx, a.TeacherID, newStartTS, a.DurationMin); err != nil {
+		return Appointment{}, err
+	}
+	if err := checkSlotFreeTx(ctx, tx, a.TeacherID, a.StudentChatID, newStartTS, newEndTS, a.ID); err != nil {
+		return Appointment{}, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE appointments
+		SET start_ts = ?, end_ts = ?
+		WHERE id = ? AND start_ts = ?
+	`, newStartTS, newEndTS, a.ID, a.StartTS)
+	if err != nil {
+		return Appointment{}, err
+	}
 	n, err := res.RowsAffected()
 	if err != nil {
-		return err
+		return Appointment{}, err
 	}
 	if n == 0 {
-		return errors.New("appointment not found")
+		return Appointment{}, ErrAppointmentChanged
 	}
-	return nil
+
+	// напоминания — к новому времени
+	if err := deleteRemindersTx(ctx, tx, a.ID); err != nil {
+		return Appointment{}, err
+	}
+	if err := enqueueRemindersTx(ctx, tx, a.ID, a.StudentChatID, newStartTS); err != nil {
+		return Appointment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Appointment{}, err
+	}
+	a.StartTS, a.EndTS = newStartTS, newEndTS
+	return a, nil
 }
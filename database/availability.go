@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrOutsideWorkingHours — преподаватель в это время не работает
+var ErrOutsideWorkingHours = errors.New("outside working hours")
+
+// Рабочее время по умолчанию (для новой базы): 09:00–21:00
+const (
+	defaultWorkStartMin = 9 * 60
+	defaultWorkEndMin   = 21 * 60
+)
+
+// Рабочее время задаётся по Москве — как и всё остальное в боте
+var workLocation = time.FixedZone("Europe/Moscow", 3*3600)
+
+// WorkingHours — рабочее время в один день, минуты от полуночи: [StartMin, EndMin)
+type WorkingHours struct {
+	StartMin int
+	EndMin   int
+	DayOff   bool
+}
+
+// Contains — занятие целиком укладывается в рабочее время
+func (h WorkingHours) Contains(startMin, durationMin int) bool {
+	return !h.DayOff && startMin >= h.StartMin && startMin+durationMin <= h.EndMin
+}
+
+// WorkingHoursException — рабочее время на конкретную дату вместо недельного шаблона
+type WorkingHoursException struct {
+	Date string // "YYYY-MM-DD"
+	WorkingHours
+}
+
+// GetWeeklyHours возвращает шаблон преподавателя на неделю (индекс — time.Weekday)
+func GetWeeklyHours(db *sql.DB, teacherID int64) ([7]WorkingHours, error) {
+	var res [7]WorkingHours
+	rows, err := db.Query(`SELECT weekday, start_min, end_min, day_off FROM working_hours WHERE teacher_id = ?`, teacherID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wd int
+		var h WorkingHours
+		if err := rows.Scan(&wd, &h.StartMin, &h.EndMin, &h.DayOff); err != nil {
+			return res, err
+		}
+		if wd >= 0 && wd < 7 {
+			res[wd] = h
+		}
+	}
+	return res, rows.Err()
+}
+
+// SetWeeklyHours меняет рабочее время преподавателя в день недели
+func SetWeeklyHours(db *sql.DB, teacherID int64, weekday time.Weekday, h WorkingHours) error {
+	_, err := db.Exec(`
+		INSERT INTO working_hours (teacher_id, weekday, start_min, end_min, day_off)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(teacher_id, weekday) DO UPDATE SET
+			start_min = excluded.start_min,
+			end_min = excluded.end_min,
+			day_off = excluded.day_off
+	`, teacherID, int(weekday), h.StartMin, h.EndMin, h.DayOff)
+	return err
+}
+
+// GetWorkingHoursExceptions возвращает исключения преподавателя начиная с даты fromDate (YYYY-MM-DD)
+func GetWorkingHoursExceptions(db *sql.DB, teacherID int64, fromDate string) ([]WorkingHoursException, error) {
+	rows, err := db.Query(`
+		SELECT date, start_min, end_min, day_off
+		FROM working_hours_exceptions
+		WHERE teacher_id = ? AND date >= ?
+		ORDER BY date
+	`, teacherID, fromDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []WorkingHoursException
+	for rows.Next() {
+		var e WorkingHoursException
+		if err := rows.Scan(&e.Date, &e.StartMin, &e.EndMin, &e.DayOff); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// SetWorkingHoursException задаёт рабочее время на дату (повторный вызов заменяет)
+func SetWorkingHoursException(db *sql.DB, teacherID int64, date string, h WorkingHours) error {
+	_, err := db.Exec(`
+		INSERT INTO working_hours_exceptions (teacher_id, date, start_min, end_min, day_off)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(teacher_id, date) DO UPDATE SET
+			start_min = excluded.start_min,
+			end_min = excluded.end_min,
+			day_off = excluded.day_off
+	`, teacherID, date, h.StartMin, h.EndMin, h.DayOff)
+	return err
+}
+
+// DeleteWorkingHoursException возвращает дате обычное рабочее время
+func DeleteWorkingHoursException(db *sql.DB, teacherID int64, date string) error {
+	_, err := db.Exec(`DELETE FROM working_hours_exceptions WHERE teacher_id = ? AND date = ?`, teacherID, date)
+	return err
+}
+
+// GetWorkingHours — рабочее время преподавателя на дату с учётом исключений
+func GetWorkingHours(db *sql.DB, teacherID int64, day time.Time) (WorkingHours, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return getWorkingHours(ctx, db, teacherID, day)
+}
+
+func getWorkingHours(ctx context.Context, q querier, teacherID int64, day time.Time) (WorkingHours, error) {
+	day = day.In(workLocation)
+
+	var h WorkingHours
+	err := q.QueryRowContext(ctx, `
+		SELECT start_min, end_min, day_off
+		FROM working_hours_exceptions
+		WHERE teacher_id = ? AND date = ?
+	`, teacherID, day.Format("2006-01-02")).Scan(&h.StartMin, &h.EndMin, &h.DayOff)
+	if err == nil {
+		return h, nil
+	}
+	if err != sql.ErrNoRows {
+		return h, err
+	}
+
+	err = q.QueryRowContext(ctx, `
+		SELECT start_min, end_min, day_off
+		FROM working_hours
+		WHERE teacher_id = ? AND weekday = ?
+	`, teacherID, int(day.Weekday())).Scan(&h.StartMin, &h.EndMin, &h.DayOff)
+	if err == sql.ErrNoRows {
+		// строки нет — день не настроен, считаем выходным
+		return WorkingHours{DayOff: true}, nil
+	}
+	return h, err
+}
+
+// checkWorkingHoursTx проверяет, что занятие попадает в рабочее время преподавателя
+func checkWorkingHoursTx(ctx context.Context, q querier, teacherID int64, startTS int64, durationMin int) error {
+	start := time.Unix(startTS, 0).In(workLocation)
+	h, err := getWorkingHours(ctx, q, teacherID, start)
+	if err != nil {
+		return err
+	}
+	if !h.Contains(start.Hour()*60+start.Minute(), durationMin) {
+		return ErrOutsideWorkingHours
+	}
+	return nil
+}
+
+// seedWorkingHours даёт преподавателям без шаблона рабочее время по умолчанию.
+// Уже настроенные дни не трогает.
+func seedWorkingHours(db *sql.DB) error {
+	for wd := 0; wd < 7; wd++ {
+		_, err := db.Exec(`
+			INSERT OR IGNORE INTO working_hours (teacher_id, weekday, start_min, end_min, day_off)
+			SELECT id, ?, ?, ?, 0 FROM teachers
+		`, wd, defaultWorkStartMin, defaultWorkEndMin)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrBlockedPeriod — время попадает в отпуск или перерыв преподавателя
+	ErrBlockedPeriod = errors.New("blocked period")
+
+	// ErrInvalidBlockedPeriod — период нельзя сохранить: даты или время не сходятся
+	ErrInvalidBlockedPeriod = errors.New("invalid blocked period")
+)
+
+// Повтор недоступности (blocked_periods.repeat)
+const (
+	BlockOnce   = ""
+	BlockWeekly = "weekly" // каждую неделю в те же дни недели, начиная с FromDate
+	BlockYearly = "yearly" // каждый год в те же даты, начиная с FromDate
+)
+
+// BlockedPeriod — когда преподаватель недоступен: в каждом дне с FromDate по ToDate
+// закрыто время [StartMin, EndMin)
+type BlockedPeriod struct {
+	ID        int64
+	TeacherID int64
+	FromDate  string // "YYYY-MM-DD"
+	ToDate    string // "YYYY-MM-DD", включительно
+	StartMin  int
+	EndMin    int
+	Repeat    string
+}
+
+// validate — ErrInvalidBlockedPeriod, если даты не разбираются, конец раньше начала,
+// окно пустое или период длиннее повтора: каждую неделю — не больше 7 дней подряд,
+// каждый год — меньше года
+func (p BlockedPeriod) validate() error {
+	from, err1 := time.Parse("2006-01-02", p.FromDate)
+	to, err2 := time.Parse("2006-01-02", p.ToDate)
+	if err1 != nil || err2 != nil || to.Before(from) {
+		return ErrInvalidBlockedPeriod
+	}
+	if p.StartMin < 0 || p.EndMin > 24*60 || p.StartMin >= p.EndMin {
+		return ErrInvalidBlockedPeriod
+	}
+
+	days := int(to.Sub(from).Hours() / 24)
+	switch p.Repeat {
+	case BlockOnce:
+	case BlockWeekly:
+		if days > 6 {
+			return ErrInvalidBlockedPeriod
+		}
+	case BlockYearly:
+		if days > 364 {
+			return ErrInvalidBlockedPeriod
+		}
+	default:
+		return ErrInvalidBlockedPeriod
+	}
+	return nil
+}
+
+// WholeDay — закрыт целый день, а не окно в нём
+func (p BlockedPeriod) WholeDay() bool {
+	return p.StartMin <= 0 && p.EndMin >= 24*60
+}
+
+// OnDay — период закрывает что-то в день day (с учётом повтора)
+func (p BlockedPeriod) OnDay(day time.Time) bool {
+	d := day.In(workLocation).Format("2006-01-02")
+	if d < p.FromDate {
+		return false
+	}
+
+	switch p.Repeat {
+	case BlockWeekly:
+		from, err1 := time.Parse("2006-01-02", p.FromDate)
+		to, err2 := time.Parse("2006-01-02", p.ToDate)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		span := int(to.Sub(from).Hours() / 24)
+		offset := (int(day.In(workLocation).Weekday()) - int(from.Weekday()) + 7) % 7
+		return offset <= span
+	case BlockYearly:
+		md, from, to := d[5:], p.FromDate[5:], p.ToDate[5:]
+		if from <= to {
+			return md >= from && md <= to
+		}
+		// через Новый год: 30.12–08.01
+		return md >= from || md <= to
+	}
+	return d <= p.ToDate
+}
+
+// Overlaps — занятие [startTS, endTS) задевает период
+func (p BlockedPeriod) Overlaps(startTS int64, endTS int64) bool {
+	start := time.Unix(startTS, 0).In(workLocation)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, workLocation)
+	if !p.OnDay(day) {
+		return false
+	}
+	startMin := (startTS - day.Unix()) / 60
+	endMin := (endTS - day.Unix()) / 60
+	return startMin < int64(p.EndMin) && endMin > int64(p.StartMin)
+}
+
+// BlockedPeriods — все периоды недоступности одного преподавателя
+type BlockedPeriods []BlockedPeriod
+
+// WholeDay — день day закрыт целиком
+func (ps BlockedPeriods) WholeDay(day time.Time) bool {
+	for _, p := range ps {
+		if p.WholeDay() && p.OnDay(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocks — занятие в день day (полночь по Москве) с startMin длительностью durationMin
+// задевает хотя бы один период
+func (ps BlockedPeriods) Blocks(day time.Time, startMin int, durationMin int) bool {
+	startTS := day.Unix() + int64(startMin)*60
+	endTS := startTS + int64(durationMin)*60
+	for _, p := range ps {
+		if p.Overlaps(startTS, endTS) {
+			return true
+		}
+	}
+	return false
+}
+
+const blockedPeriodColumns = `id, teacher_id, from_date, to_date, start_min, end_min, repeat`
+
+func scanBlockedPeriods(rows *sql.Rows) (BlockedPeriods, error) {
+	var res BlockedPeriods
+	for rows.Next() {
+		var p BlockedPeriod
+		if err := rows.Scan(&p.ID, &p.TeacherID, &p.FromDate, &p.ToDate, &p.StartMin, &p.EndMin, &p.Repeat); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// AddBlockedPeriod сохраняет период недоступности и возвращает его id.
+// Несходящийся период (см. validate) не сохраняется — ErrInvalidBlockedPeriod.
+func AddBlockedPeriod(db *sql.DB, p BlockedPeriod) (int64, error) {
+	if err := p.validate(); err != nil {
+		return 0, err
+	}
+	res, err := db.Exec(`
+		INSERT INTO blocked_periods (teacher_id, from_date, to_date, start_min, end_min, repeat, created_ts)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, p.TeacherID, p.FromDate, p.ToDate, p.StartMin, p.EndMin, p.Repeat, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetBlockedPeriods — периоды преподавателя, которые ещё действуют на fromDate (YYYY-MM-DD)
+// или позже: разовые, не закончившиеся раньше, и все повторяющиеся
+func GetBlockedPeriods(db *sql.DB, teacherID int64, fromDate string) (BlockedPeriods, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return getBlockedPeriods(ctx, db, teacherID, fromDate)
+}
+
+func getBlockedPeriods(ctx context.Context, q querier, teacherID int64, fromDate string) (BlockedPeriods, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+blockedPeriodColumns+`
+		FROM blocked_periods
+		WHERE teacher_id = ? AND (repeat != '' OR to_date >= ?)
+		ORDER BY from_date, start_min, id
+	`, teacherID, fromDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBlockedPeriods(rows)
+}
+
+// GetBlockedPeriod возвращает период по id
+func GetBlockedPeriod(db *sql.DB, id int64) (BlockedPeriod, bool, error) {
+	rows, err := db.Query(`SELECT `+blockedPeriodColumns+` FROM blocked_periods WHERE id = ?`, id)
+	if err != nil {
+		return BlockedPeriod{}, false, err
+	}
+	defer rows.Close()
+	list, err := scanBlockedPeriods(rows)
+	if err != nil || len(list) == 0 {
+		return BlockedPeriod{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// DeleteBlockedPeriod удаляет период id преподавателя teacherID.
+// false — такого периода у него нет.
+func DeleteBlockedPeriod(db *sql.DB, id int64, teacherID int64) (bool, error) {
+	res, err := db.Exec(`DELETE FROM blocked_periods WHERE id = ? AND teacher_id = ?`, id, teacherID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetBlockedAppointments — будущие записи преподавателя, которые попали в период p.
+// Читаются только записи в пределах периода: для разового — с FromDate по ToDate,
+// для повторяющегося — до последней записи преподавателя.
+func GetBlockedAppointments(db *sql.DB, p BlockedPeriod) ([]Appointment, error) {
+	from, err := time.ParseInLocation("2006-01-02", p.FromDate, workLocation)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(workLocation)
+	if from.Before(now) {
+		from = now
+	}
+	var toTS int64
+	if p.Repeat == BlockOnce {
+		last, err := time.ParseInLocation("2006-01-02", p.ToDate, workLocation)
+		if err != nil {
+			return nil, err
+		}
+		toTS = last.AddDate(0, 0, 1).Unix()
+	} else {
+		err := db.QueryRow(`
+			SELECT COALESCE(MAX(start_ts), 0) FROM appointments WHERE teacher_id = ?
+		`, p.TeacherID).Scan(&toTS)
+		if err != nil {
+			return nil, err
+		}
+		toTS++ // последняя запись тоже попадает в выборку
+	}
+
+	rows, err := db.Query(`
+		SELECT `+appointmentColumns+`
+		FROM appointments
+		WHERE teacher_id = ? AND start_ts > ? AND start_ts < ?
+		ORDER BY start_ts
+	`, p.TeacherID, from.Unix(), toTS)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	apps, err := scanAppointments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Appointment
+	for _, a := range apps {
+		if p.Overlaps(a.StartTS, a.EndTS) {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+// checkBlockedTx — ErrBlockedPeriod, если [startTS, endTS) задевает недоступность преподавателя
+func checkBlockedTx(ctx context.Context, q querier, teacherID int64, startTS int64, endTS int64) error {
+	date := time.Unix(startTS, 0).In(workLocation).Format("2006-01-02")
+	periods, err := getBlockedPeriods(ctx, q, teacherID, date)
+	if err != nil {
+		return err
+	}
+	for _, p := range periods {
+		if p.Overlaps(startTS, endTS) {
+			return ErrBlockedPeriod
+		}
+	}
+	return nil
+}
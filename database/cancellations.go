@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Кто отменил занятие (cancellations.canceled_by)
+const (
+	CanceledByStudent = "student"
+	CanceledByTeacher = "teacher"
+)
+
+// Cancellation — отменённое занятие в истории отмен
+type Cancellation struct {
+	ID            int64
+	AppointmentID int64
+	TeacherID     int64
+	StudentChatID int64
+	StudentName   string
+	StartTS       int64
+	DurationMin   int
+	SeriesID      int64
+	CanceledTS    int64
+	CanceledBy    string
+	Reason        string // "" — причина не указана
+	Late          bool   // позже срока бесплатной отмены
+	ChargePercent int    // сколько процентов занятия оплачивается; 0 — бесплатно
+	Waived        bool   // преподаватель простил позднюю отмену
+}
+
+// CancelTerms — кто, почему и по каким правилам отменяет
+type CancelTerms struct {
+	By            string // CanceledByStudent или CanceledByTeacher
+	Reason        string // причина для другой стороны; "" — без причины
+	LateBeforeTS  int64  // занятия, начинающиеся раньше, отменяются поздно; 0 — поздних нет
+	ChargePercent int    // сколько процентов занятия оплачивается при поздней отмене
+}
+
+const cancellationColumns = `id, appointment_id, teacher_id, student_chat_id, student_name, start_ts, duration_min, series_id, canceled_ts, canceled_by, reason, late, charge_percent, waived`
+
+func scanCancellations(rows *sql.Rows) ([]Cancellation, error) {
+	var res []Cancellation
+	for rows.Next() {
+		var c Cancellation
+		if err := rows.Scan(
+			&c.ID,
+			&c.AppointmentID,
+			&c.TeacherID,
+			&c.StudentChatID,
+			&c.StudentName,
+			&c.StartTS,
+			&c.DurationMin,
+			&c.SeriesID,
+			&c.CanceledTS,
+			&c.CanceledBy,
+			&c.Reason,
+			&c.Late,
+			&c.ChargePercent,
+			&c.Waived,
+		); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+// CancelAppointmentTx атомарно удаляет запись a вместе с напоминаниями и записывает отмену
+// в историю. Если запись успели отменить или перенести — ErrAppointmentChanged.
+func CancelAppointmentTx(db *sql.DB, a Appointment, terms CancelTerms) (Cancellation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Cancellation{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM appointments WHERE id = ? AND start_ts = ?`, a.ID, a.StartTS)
+	if err != nil {
+		return Cancellation{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Cancellation{}, err
+	}
+	if n == 0 {
+		return Cancellation{}, ErrAppointmentChanged
+	}
+
+	c, err := cancelAppointmentTx(ctx, tx, a, terms)
+	if err != nil {
+		return Cancellation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Cancellation{}, err
+	}
+	return c, nil
+}
+
+// cancelAppointmentTx — уже удалённую из appointments запись a: убирает напоминания
+// и добавляет в историю отмен
+func cancelAppointmentTx(ctx context.Context, tx *sql.Tx, a Appointment, terms CancelTerms) (Cancellation, error) {
+	if err := deleteRemindersTx(ctx, tx, a.ID); err != nil {
+		return Cancellation{}, err
+	}
+
+	c := Cancellation{
+		AppointmentID: a.ID,
+		TeacherID:     a.TeacherID,
+		StudentChatID: a.StudentChatID,
+		StudentName:   a.StudentName,
+		StartTS:       a.StartTS,
+		DurationMin:   a.DurationMin,
+		SeriesID:      a.SeriesID,
+		CanceledTS:    time.Now().Unix(),
+		CanceledBy:    terms.By,
+		Reason:        terms.Reason,
+		Late:          a.StartTS < terms.LateBeforeTS,
+	}
+	if c.Late {
+		c.ChargePercent = terms.ChargePercent
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO cancellations (appointment_id, teacher_id, student_chat_id, student_name, start_ts, duration_min, series_id, canceled_ts, canceled_by, reason, late, charge_percent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.AppointmentID, c.TeacherID, c.StudentChatID, c.StudentName, c.StartTS, c.DurationMin, c.SeriesID, c.CanceledTS, c.CanceledBy, c.Reason, c.Late, c.ChargePercent)
+	if err != nil {
+		return Cancellation{}, err
+	}
+	c.ID, err = res.LastInsertId()
+	return c, err
+}
+
+// GetCancellation возвращает отмену по id
+func GetCancellation(db *sql.DB, id int64) (Cancellation, bool, error) {
+	rows, err := db.Query(`SELECT `+cancellationColumns+` FROM cancellations WHERE id = ?`, id)
+	if err != nil {
+		return Cancellation{}, false, err
+	}
+	defer rows.Close()
+	list, err := scanCancellations(rows)
+	if err != nil || len(list) == 0 {
+		return Cancellation{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// GetLateCancellations — поздние отмены у преподавателя по занятиям, начинавшимся с fromTS,
+// свежие первыми
+func GetLateCancellations(db *sql.DB, teacherID int64, fromTS int64) ([]Cancellation, error) {
+	rows, err := db.Query(`
+		SELECT `+cancellationColumns+`
+		FROM cancellations
+		WHERE teacher_id = ? AND late = 1 AND start_ts >= ?
+		ORDER BY start_ts DESC
+	`, teacherID, fromTS)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanCancellations(rows)
+}
+
+// WaiveCancellation — преподаватель teacherID прощает позднюю отмену id.
+// false — такой непрощённой поздней отмены у него нет.
+func WaiveCancellation(db *sql.DB, id int64, teacherID int64) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE cancellations SET waived = 1
+		WHERE id = ? AND teacher_id = ? AND late = 1 AND waived = 0
+	`, id, teacherID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -6,8 +6,11 @@ func ClearStudentsAndAppointments(db *sql.DB) error {
 	_, err := db.Exec(`
 		DELETE FROM students;
 		DELETE FROM appointments;
+		DELETE FROM series;
+		DELETE FROM waitlist;
+		DELETE FROM cancellations;
 		DELETE FROM reminders;
-		DELETE FROM sqlite_sequence WHERE name IN ('appointments','reminders');
+		DELETE FROM sqlite_sequence WHERE name IN ('appointments','series','reminders','waitlist','cancellations');
 	`)
 	return err
 }
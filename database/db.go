@@ -15,18 +15,23 @@ func dbPath() string {
 	return filepath.Join("data", "app.db")
 }
 
-func Open() (*sql.DB, error) {
+// Open открывает базу и доводит схему до текущей. primaryTeacher — логин основного
+// преподавателя (PRIMARY_TEACHER), пусто — отметка остаётся прежней.
+func Open(primaryTeacher string) (*sql.DB, error) {
 	path := dbPath()
 	_ = os.MkdirAll(filepath.Dir(path), 0755)
 
-	db, err := sql.Open("sqlite3", path)
+	// Настройки в DSN применяются к каждому соединению пула, а не к одному.
+	// Обновления обрабатываются параллельно, поэтому:
+	// _busy_timeout — ждём освобождения базы, а не падаем с "database is locked";
+	// _txlock=immediate — транзакция сразу берёт блокировку на запись, и две
+	// проверки пересечения записей не могут пройти одновременно.
+	dsn := path + "?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	_, _ = db.Exec("PRAGMA journal_mode=WAL;")
-	_, _ = db.Exec("PRAGMA synchronous=NORMAL;")
-
 	// students
 	_, err = db.Exec(`
 CREATE TABLE IF NOT EXISTS students (
@@ -38,7 +43,24 @@ CREATE TABLE IF NOT EXISTS students (
 		return nil, err
 	}
 
-	// teachers
+	// active = 0 — ученик заблокировал бота, писать ему бесполезно
+	if err := addColumn(db, "students", "active", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// placeholder = 1 — ученик без Telegram, которого завёл преподаватель owner_teacher_id
+	if err := addColumn(db, "students", "placeholder", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := addColumn(db, "students", "owner_teacher_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// teachers (chat_id — от версии с одним преподавателем, не используется: чаты входа
+	// хранятся в teacher_sessions; is_primary — основной преподаватель, см. setPrimaryTeacher)
 	_, err = db.Exec(`
 CREATE TABLE IF NOT EXISTS teachers (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -52,6 +74,46 @@ CREATE TABLE IF NOT EXISTS teachers (
 		return nil, err
 	}
 
+	// name — как преподаватель называется у учеников (пусто — показываем логин)
+	if err := addColumn(db, "teachers", "name", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// основного отмечаем до переноса старых записей ниже: они достаются ему
+	if primaryTeacher != "" {
+		if err := setPrimaryTeacher(db, primaryTeacher); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	// teacher_sessions (вход преподавателя; у одного преподавателя может быть несколько устройств)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS teacher_sessions (
+	chat_id INTEGER PRIMARY KEY,
+	teacher_id INTEGER NOT NULL,
+	created_ts INTEGER NOT NULL,
+	expires_ts INTEGER NOT NULL
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// sessions (состояние диалога: шаг записи, ввод имени, логина и т.п.)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS sessions (
+	chat_id INTEGER PRIMARY KEY,
+	data TEXT NOT NULL,
+	updated_ts INTEGER NOT NULL,
+	expires_ts INTEGER NOT NULL
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	// appointments (записи)
 	_, err = db.Exec(`
 CREATE TABLE IF NOT EXISTS appointments (
@@ -68,6 +130,107 @@ CREATE TABLE IF NOT EXISTS appointments (
 		return nil, err
 	}
 
+	// teacher_id — к кому запись. Старые записи (до нескольких преподавателей)
+	// достаются основному преподавателю, а если его не отметили — первому.
+	if err := addColumn(db, "appointments", "teacher_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	_, err = db.Exec(`
+UPDATE appointments
+SET teacher_id = COALESCE((SELECT id FROM teachers ORDER BY is_primary DESC, id LIMIT 1), 0)
+WHERE teacher_id = 0;`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// series_id — серия, к которой относится занятие (0 — разовая запись)
+	if err := addColumn(db, "appointments", "series_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// series (повторяющиеся занятия: правило, начало, конец, длительность, ученик)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS series (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	teacher_id INTEGER NOT NULL,
+	student_chat_id INTEGER NOT NULL,
+	student_name TEXT NOT NULL,
+	rule TEXT NOT NULL,
+	start_ts INTEGER NOT NULL,
+	until_ts INTEGER NOT NULL,
+	duration_min INTEGER NOT NULL,
+	created_ts INTEGER NOT NULL,
+	canceled_ts INTEGER
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// waitlist (лист ожидания: ученик ждёт время start_min на дату date у преподавателя,
+	// start_min = -1 — любое время в этот день; offer_* — предложенное освободившееся время)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS waitlist (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	teacher_id INTEGER NOT NULL,
+	student_chat_id INTEGER NOT NULL,
+	student_name TEXT NOT NULL,
+	date TEXT NOT NULL,
+	start_min INTEGER NOT NULL,
+	duration_min INTEGER NOT NULL,
+	created_ts INTEGER NOT NULL,
+	offer_start_ts INTEGER NOT NULL DEFAULT 0,
+	offer_expires_ts INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (teacher_id, student_chat_id, date, start_min)
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_waitlist_day ON waitlist(teacher_id, date, created_ts);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// cancellations (история отмен: запись удаляется из appointments, а здесь остаётся,
+	// кто и когда отменил; late = 1 — позже срока бесплатной отмены, charge_percent — сколько
+	// процентов занятия оплачивается, waived = 1 — преподаватель простил позднюю отмену)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS cancellations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	appointment_id INTEGER NOT NULL,
+	teacher_id INTEGER NOT NULL,
+	student_chat_id INTEGER NOT NULL,
+	student_name TEXT NOT NULL,
+	start_ts INTEGER NOT NULL,
+	duration_min INTEGER NOT NULL,
+	series_id INTEGER NOT NULL DEFAULT 0,
+	canceled_ts INTEGER NOT NULL,
+	canceled_by TEXT NOT NULL,
+	late INTEGER NOT NULL DEFAULT 0,
+	charge_percent INTEGER NOT NULL DEFAULT 0,
+	waived INTEGER NOT NULL DEFAULT 0
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_cancellations_teacher ON cancellations(teacher_id, late, start_ts);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// reason — причина отмены, которую указал отменивший ("" — не указана)
+	if err := addColumn(db, "cancellations", "reason", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	// индексы на appointments
 	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_appointments_start ON appointments(start_ts);`)
 	if err != nil {
@@ -79,6 +242,16 @@ CREATE TABLE IF NOT EXISTS appointments (
 		_ = db.Close()
 		return nil, err
 	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_appointments_teacher ON appointments(teacher_id, start_ts);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_appointments_series ON appointments(series_id, start_ts);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 
 	// user_settings (настройки напоминаний)
 	_, err = db.Exec(`
@@ -92,6 +265,18 @@ CREATE TABLE IF NOT EXISTS user_settings (
 		return nil, err
 	}
 
+	// user_reminder_offsets (за сколько минут напоминать; может быть несколько значений)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS user_reminder_offsets (
+	chat_id INTEGER NOT NULL,
+	before_min INTEGER NOT NULL,
+	PRIMARY KEY (chat_id, before_min)
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	// reminders (очередь напоминаний)
 	_, err = db.Exec(`
 CREATE TABLE IF NOT EXISTS reminders (
@@ -107,11 +292,104 @@ CREATE TABLE IF NOT EXISTS reminders (
 		return nil, err
 	}
 
+	// attempts — сколько раз отправка не удалась; next_try_ts — раньше этого не повторять
+	if err := addColumn(db, "reminders", "attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := addColumn(db, "reminders", "next_try_ts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_reminders_due ON reminders(sent_ts, send_at_ts);`)
 	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
 
+	// одно напоминание каждого вида на запись — повторная постановка в очередь ничего не дублирует
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_reminders_uniq ON reminders(appointment_id, recipient_chat_id, kind);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// working_hours (недельный шаблон рабочего времени каждого преподавателя:
+	// по строке на день недели, минуты от полуночи по Москве, [start_min, end_min))
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS working_hours (
+	teacher_id INTEGER NOT NULL,
+	weekday INTEGER NOT NULL,
+	start_min INTEGER NOT NULL,
+	end_min INTEGER NOT NULL,
+	day_off INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (teacher_id, weekday)
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// по умолчанию — каждый день 09:00–21:00; изменённые дни не трогаем
+	if err := seedWorkingHours(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// working_hours_exceptions (рабочее время преподавателя на конкретную дату вместо шаблона)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS working_hours_exceptions (
+	teacher_id INTEGER NOT NULL,
+	date TEXT NOT NULL,
+	start_min INTEGER NOT NULL,
+	end_min INTEGER NOT NULL,
+	day_off INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (teacher_id, date)
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// blocked_periods (отпуск, праздники, перерывы: с from_date по to_date включительно
+	// в каждом дне закрыто [start_min, end_min), целый день — 0..1440;
+	// repeat: "" — один раз, "weekly" — каждую неделю, "yearly" — каждый год)
+	_, err = db.Exec(`
+CREATE TABLE IF NOT EXISTS blocked_periods (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	teacher_id INTEGER NOT NULL,
+	from_date TEXT NOT NULL,
+	to_date TEXT NOT NULL,
+	start_min INTEGER NOT NULL DEFAULT 0,
+	end_min INTEGER NOT NULL DEFAULT 1440,
+	repeat TEXT NOT NULL DEFAULT '',
+	created_ts INTEGER NOT NULL
+);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_blocked_periods_teacher ON blocked_periods(teacher_id, to_date);`)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
+
+// addColumn добавляет колонку в существующую таблицу, если её ещё нет
+// (в SQLite нет ADD COLUMN IF NOT EXISTS)
+func addColumn(db *sql.DB, table, column, decl string) error {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(1) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl)
+	return err
+}
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ограничения серии: не больше MaxOccurrences занятий и не дальше MaxSeriesMonths от первого
+const (
+	MaxOccurrences  = 60
+	MaxSeriesMonths = 12
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// Recurrence — правило повторения серии, подмножество RRULE из iCalendar:
+// FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;UNTIL=20261231 (или COUNT=10 вместо UNTIL).
+type Recurrence struct {
+	Interval int            // раз в сколько недель, ≥ 1
+	Weekdays []time.Weekday // дни недели; пусто — день первого занятия
+	Until    string         // "YYYY-MM-DD" включительно; "" — не задано
+	Count    int            // сколько занятий всего; 0 — не задано
+}
+
+var rruleDays = map[time.Weekday]string{
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+	time.Sunday:    "SU",
+}
+
+// ParseRule разбирает строку правила. Правила старых серий ("FREQ=WEEKLY;INTERVAL=1")
+// тоже разбираются — без дней недели и окончания.
+func ParseRule(s string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return Recurrence{}, ErrInvalidRule
+		}
+		switch k {
+		case "FREQ":
+			if v != "WEEKLY" {
+				return Recurrence{}, ErrInvalidRule
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return Recurrence{}, ErrInvalidRule
+			}
+			r.Interval = n
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				wd, ok := parseRuleDay(d)
+				if !ok {
+					return Recurrence{}, ErrInvalidRule
+				}
+				r.Weekdays = append(r.Weekdays, wd)
+			}
+		case "UNTIL":
+			d, err := time.Parse("20060102", v)
+			if err != nil {
+				return Recurrence{}, ErrInvalidRule
+			}
+			r.Until = d.Format("2006-01-02")
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return Recurrence{}, ErrInvalidRule
+			}
+			r.Count = n
+		default:
+			return Recurrence{}, ErrInvalidRule
+		}
+	}
+	r.Weekdays = sortWeekdays(r.Weekdays)
+	return r, nil
+}
+
+func parseRuleDay(s string) (time.Weekday, bool) {
+	for wd, name := range rruleDays {
+		if name == s {
+			return wd, true
+		}
+	}
+	return 0, false
+}
+
+// String — правило в виде для series.rule
+func (r Recurrence) String() string {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	s := "FREQ=WEEKLY;INTERVAL=" + strconv.Itoa(interval)
+	if len(r.Weekdays) > 0 {
+		var days []string
+		for _, wd := range sortWeekdays(r.Weekdays) {
+			days = append(days, rruleDays[wd])
+		}
+		s += ";BYDAY=" + strings.Join(days, ",")
+	}
+	if r.Until != "" {
+		s += ";UNTIL=" + strings.ReplaceAll(r.Until, "-", "")
+	}
+	if r.Count > 0 {
+		s += ";COUNT=" + strconv.Itoa(r.Count)
+	}
+	return s
+}
+
+// Has — входит ли день недели в правило
+func (r Recurrence) Has(wd time.Weekday) bool {
+	for _, d := range r.Weekdays {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// Toggle добавляет день недели в правило или убирает его
+func (r *Recurrence) Toggle(wd time.Weekday) {
+	var days []time.Weekday
+	for _, d := range r.Weekdays {
+		if d != wd {
+			days = append(days, d)
+		}
+	}
+	if len(days) == len(r.Weekdays) {
+		days = append(days, wd)
+	}
+	r.Weekdays = sortWeekdays(days)
+}
+
+// Occurrences — начала занятий серии с первым занятием start (само start входит,
+// если его день недели есть в правиле). Недели считаются с понедельника недели start.
+// Без UNTIL и COUNT серия ограничена MaxSeriesMonths; в любом случае — не больше MaxOccurrences.
+func (r Recurrence) Occurrences(start time.Time) []time.Time {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	days := r.Weekdays
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+
+	limit := start.AddDate(0, MaxSeriesMonths, 0)
+	if r.Until != "" {
+		if until, err := time.ParseInLocation("2006-01-02", r.Until, start.Location()); err == nil {
+			until = until.AddDate(0, 0, 1) // включительно
+			if until.Before(limit) {
+				limit = until
+			}
+		}
+	}
+
+	// понедельник недели первого занятия
+	monday := time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), start.Minute(), 0, 0, start.Location())
+	monday = monday.AddDate(0, 0, -((int(monday.Weekday()) + 6) % 7))
+
+	var res []time.Time
+	for week := monday; week.Before(limit); week = week.AddDate(0, 0, 7*interval) {
+		for _, wd := range days {
+			t := week.AddDate(0, 0, (int(wd)+6)%7)
+			if t.Before(start) {
+				continue
+			}
+			if !t.Before(limit) {
+				return res
+			}
+			res = append(res, t)
+			if len(res) == MaxOccurrences || (r.Count > 0 && len(res) == r.Count) {
+				return res
+			}
+		}
+	}
+	return res
+}
+
+// sortWeekdays — по порядку с понедельника, без повторов
+func sortWeekdays(days []time.Weekday) []time.Weekday {
+	seen := make(map[time.Weekday]bool)
+	var res []time.Weekday
+	for _, d := range days {
+		if !seen[d] {
+			seen[d] = true
+			res = append(res, d)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return (int(res[i])+6)%7 < (int(res[j])+6)%7
+	})
+	return res
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Reminder struct {
+	ID              int64
+	AppointmentID   int64
+	RecipientChatID int64
+	SendAtTS        int64
+	Kind            string
+	Attempts        int // сколько раз отправка уже не удалась
+
+	// данные записи — для текста напоминания
+	StartTS     int64
+	DurationMin int
+}
+
+type UserSettings struct {
+	RemindersEnabled bool
+	RemindBeforeMin  int   // за сколько минут до начала напоминать (ближайшее из выбранных)
+	ExtraBeforeMin   []int // ещё напоминания, если ученик выбрал несколько времён; по возрастанию
+}
+
+// Значения по умолчанию совпадают с DEFAULT в таблице user_settings
+var defaultUserSettings = UserSettings{RemindersEnabled: true, RemindBeforeMin: 60}
+
+// Leads — все времена напоминаний (в минутах до начала) по возрастанию
+func (s UserSettings) Leads() []int {
+	res := append([]int{s.RemindBeforeMin}, s.ExtraBeforeMin...)
+	sort.Ints(res)
+	return slices.Compact(res)
+}
+
+// SetLeads задаёт времена напоминаний (хотя бы одно): ближайшее — в RemindBeforeMin,
+// остальные — в ExtraBeforeMin
+func (s *UserSettings) SetLeads(mins []int) {
+	mins = append([]int(nil), mins...)
+	sort.Ints(mins)
+	mins = slices.Compact(mins)
+	if len(mins) == 0 {
+		mins = []int{defaultUserSettings.RemindBeforeMin}
+	}
+	s.RemindBeforeMin, s.ExtraBeforeMin = mins[0], mins[1:]
+}
+
+// getUserSettingsTx читает настройки напоминаний (или значения по умолчанию, если их ещё нет).
+// Несколько времён хранятся в user_reminder_offsets; если их не задавали — одно из user_settings.
+func getUserSettingsTx(ctx context.Context, q querier, chatID int64) (UserSettings, error) {
+	s := defaultUserSettings
+	var enabled int
+	err := q.QueryRowContext(ctx, `
+		SELECT reminders_enabled, remind_before_min
+		FROM user_settings
+		WHERE chat_id = ?
+	`, chatID).Scan(&enabled, &s.RemindBeforeMin)
+	if err == sql.ErrNoRows {
+		return s, nil
+	}
+	if err != nil {
+		return UserSettings{}, err
+	}
+	s.RemindersEnabled = enabled != 0
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT before_min
+		FROM user_reminder_offsets
+		WHERE chat_id = ?
+		ORDER BY before_min
+	`, chatID)
+	if err != nil {
+		return UserSettings{}, err
+	}
+	defer rows.Close()
+
+	var leads []int
+	for rows.Next() {
+		var m int
+		if err := rows.Scan(&m); err != nil {
+			return UserSettings{}, err
+		}
+		leads = append(leads, m)
+	}
+	if err := rows.Err(); err != nil {
+		return UserSettings{}, err
+	}
+	if len(leads) > 0 {
+		s.SetLeads(leads)
+	}
+	return s, nil
+}
+
+// reminderKind — вид напоминания, например "before:60"
+func reminderKind(beforeMin int) string {
+	return "before:" + strconv.Itoa(beforeMin)
+}
+
+// enqueueRemindersTx ставит напоминания для записи в очередь (в рамках уже открытой транзакции)
+// — по одному на каждое выбранное учеником время. Напоминания, время отправки
+// которых уже прошло, не создаются.
+func enqueueRemindersTx(ctx context.Context, tx *sql.Tx, appointmentID int64, chatID int64, startTS int64) error {
+	placeholder, err := isPlaceholderStudent(ctx, tx, chatID)
+	if err != nil {
+		return err
+	}
+	if placeholder {
+		// ученику без Telegram напоминать некуда
+		return nil
+	}
+	s, err := getUserSettingsTx(ctx, tx, chatID)
+	if err != nil {
+		return err
+	}
+	if !s.RemindersEnabled {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	for _, before := range s.Leads() {
+		sendAt := startTS - int64(before)*60
+		if sendAt <= now {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO reminders (appointment_id, recipient_chat_id, send_at_ts, kind)
+			VALUES (?, ?, ?, ?);
+		`, appointmentID, chatID, sendAt, reminderKind(before))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rescheduleStudentRemindersTx убирает неотправленные напоминания будущих записей ученика
+// и ставит их заново по текущим настройкам
+func rescheduleStudentRemindersTx(ctx context.Context, tx *sql.Tx, chatID int64) error {
+	now := time.Now().Unix()
+
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM reminders
+		WHERE recipient_chat_id = ?
+		  AND sent_ts IS NULL
+		  AND appointment_id IN (SELECT id FROM appointments WHERE student_chat_id = ? AND start_ts > ?)
+	`, chatID, chatID, now)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, start_ts
+		FROM appointments
+		WHERE student_chat_id = ? AND start_ts > ?
+	`, chatID, now)
+	if err != nil {
+		return err
+	}
+
+	type future struct{ id, startTS int64 }
+	var apps []future
+	for rows.Next() {
+		var f future
+		if err := rows.Scan(&f.id, &f.startTS); err != nil {
+			rows.Close()
+			return err
+		}
+		apps = append(apps, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range apps {
+		if err := enqueueRemindersTx(ctx, tx, a.id, chatID, a.startTS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRemindersTx удаляет все напоминания записи
+func deleteRemindersTx(ctx context.Context, tx *sql.Tx, appointmentID int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM reminders WHERE appointment_id = ?`, appointmentID)
+	return err
+}
+
+// GetDueReminders возвращает неотправленные напоминания, время которых наступило.
+// Ученики, заблокировавшие бота, и напоминания, повтор которых ещё рано, пропускаются.
+func GetDueReminders(db *sql.DB, nowTS int64, limit int) ([]Reminder, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.appointment_id, r.recipient_chat_id, r.send_at_ts, r.kind, r.attempts, a.start_ts, a.duration_min
+		FROM reminders r
+		JOIN appointments a ON a.id = r.appointment_id
+		WHERE r.sent_ts IS NULL AND r.send_at_ts <= ? AND r.next_try_ts <= ?
+		  AND NOT EXISTS (SELECT 1 FROM students s WHERE s.chat_id = r.recipient_chat_id AND s.active = 0)
+		ORDER BY r.send_at_ts
+		LIMIT ?
+	`, nowTS, nowTS, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Reminder
+	for rows.Next() {
+		var r Reminder
+		if err := rows.Scan(
+			&r.ID,
+			&r.AppointmentID,
+			&r.RecipientChatID,
+			&r.SendAtTS,
+			&r.Kind,
+			&r.Attempts,
+			&r.StartTS,
+			&r.DurationMin,
+		); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+// ClaimReminder помечает напоминание отправленным до фактической отправки.
+// Возвращает false, если его уже забрал кто-то другой — так одно напоминание
+// не уходит дважды даже после перезапуска.
+func ClaimReminder(db *sql.DB, id int64, sentTS int64) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE reminders
+		SET sent_ts = ?
+		WHERE id = ? AND sent_ts IS NULL
+	`, sentTS, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseReminder возвращает напоминание в очередь после неудачной отправки:
+// попытка засчитывается, следующая — не раньше nextTryTS
+func ReleaseReminder(db *sql.DB, id int64, nextTryTS int64) error {
+	_, err := db.Exec(`
+		UPDATE reminders
+		SET sent_ts = NULL, attempts = attempts + 1, next_try_ts = ?
+		WHERE id = ?
+	`, nextTryTS, id)
+	return err
+}
@@ -0,0 +1,222 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Series — повторяющиеся занятия ученика у преподавателя.
+// Сами занятия — обычные записи в appointments с series_id = ID.
+type Series struct {
+	ID            int64
+	TeacherID     int64
+	StudentChatID int64
+	StudentName   string
+	Rule          string // правило повтора, см. Recurrence
+	StartTS       int64  // первое занятие
+	UntilTS       int64  // занятий позже этого момента в серии нет
+	DurationMin   int
+	CreatedTS     int64
+	CanceledTS    int64 // 0 — серия действует
+}
+
+const seriesColumns = `id, teacher_id, student_chat_id, student_name, rule, start_ts, until_ts, duration_min, created_ts, COALESCE(canceled_ts, 0)`
+
+func scanSeries(row interface{ Scan(...interface{}) error }) (Series, error) {
+	var s Series
+	err := row.Scan(
+		&s.ID,
+		&s.TeacherID,
+		&s.StudentChatID,
+		&s.StudentName,
+		&s.Rule,
+		&s.StartTS,
+		&s.UntilTS,
+		&s.DurationMin,
+		&s.CreatedTS,
+		&s.CanceledTS,
+	)
+	return s, err
+}
+
+// SeriesConflict — занятие серии, которое не удалось создать
+type SeriesConflict struct {
+	StartTS int64
+	Err     error // ErrSlotBusy, ErrOutsideWorkingHours или ErrBlockedPeriod
+}
+
+// CreateSeriesTx в одной транзакции сохраняет серию s и её занятия с началами starts.
+// Занятые и нерабочие даты возвращаются в conflicts; если allOrNothing, при первом же
+// конфликте не создаётся ничего. Если не создано ни одного занятия, серии тоже нет (id = 0).
+func CreateSeriesTx(db *sql.DB, s Series, starts []int64, allOrNothing bool) (int64, []SeriesConflict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO series (teacher_id, student_chat_id, student_name, rule, start_ts, until_ts, duration_min, created_ts)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.TeacherID, s.StudentChatID, s.StudentName, s.Rule, s.StartTS, s.UntilTS, s.DurationMin, time.Now().Unix())
+	if err != nil {
+		return 0, nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var conflicts []SeriesConflict
+	for _, start := range starts {
+		_, err := insertAppointmentTx(ctx, tx, NewAppointment{
+			TeacherID:     s.TeacherID,
+			StudentChatID: s.StudentChatID,
+			StudentName:   s.StudentName,
+			StartTS:       start,
+			DurationMin:   s.DurationMin,
+			SeriesID:      id,
+		})
+		switch {
+		case err == ErrSlotBusy || err == ErrOutsideWorkingHours || err == ErrBlockedPeriod:
+			conflicts = append(conflicts, SeriesConflict{StartTS: start, Err: err})
+			if allOrNothing {
+				return 0, conflicts, nil
+			}
+		case err != nil:
+			return 0, nil, err
+		}
+	}
+
+	// пустая серия не нужна
+	if len(conflicts) == len(starts) {
+		return 0, conflicts, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return id, conflicts, nil
+}
+
+// GetSeries возвращает серию по id
+func GetSeries(db *sql.DB, id int64) (Series, bool, error) {
+	s, err := scanSeries(db.QueryRow(`SELECT `+seriesColumns+` FROM series WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return Series{}, false, nil
+	}
+	if err != nil {
+		return Series{}, false, err
+	}
+	return s, true, nil
+}
+
+// GetStudentSeries — действующие серии ученика, в которых ещё есть будущие занятия
+func GetStudentSeries(db *sql.DB, chatID int64) ([]Series, error) {
+	return querySeries(db, `student_chat_id = ?`, chatID)
+}
+
+// GetTeacherSeries — действующие серии к преподавателю, в которых ещё есть будущие занятия
+func GetTeacherSeries(db *sql.DB, teacherID int64) ([]Series, error) {
+	return querySeries(db, `teacher_id = ?`, teacherID)
+}
+
+func querySeries(db *sql.DB, where string, arg interface{}) ([]Series, error) {
+	rows, err := db.Query(`
+		SELECT `+seriesColumns+`
+		FROM series s
+		WHERE `+where+`
+		  AND canceled_ts IS NULL
+		  AND EXISTS (SELECT 1 FROM appointments a WHERE a.series_id = s.id AND a.start_ts > ?)
+		ORDER BY start_ts
+	`, arg, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Series
+	for rows.Next() {
+		s, err := scanSeries(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// GetSeriesAppointments — занятия серии, которые начнутся после fromTS
+func GetSeriesAppointments(db *sql.DB, seriesID int64, fromTS int64) ([]Appointment, error) {
+	rows, err := db.Query(`
+		SELECT `+appointmentColumns+`
+		FROM appointments
+		WHERE series_id = ? AND start_ts > ?
+		ORDER BY start_ts
+	`, seriesID, fromTS)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanAppointments(rows)
+}
+
+// CancelSeriesTx отменяет серию: удаляет занятия, которые начнутся после fromTS
+// (вместе с напоминаниями, в историю отмен — по terms), и помечает серию отменённой.
+// Возвращает отмены — чтобы было кого уведомить.
+func CancelSeriesTx(db *sql.DB, seriesID int64, fromTS int64, terms CancelTerms) ([]Cancellation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+appointmentColumns+`
+		FROM appointments
+		WHERE series_id = ? AND start_ts > ?
+		ORDER BY start_ts
+	`, seriesID, fromTS)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := scanAppointments(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var canceled []Cancellation
+	for _, a := range apps {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM appointments WHERE id = ?`, a.ID); err != nil {
+			return nil, err
+		}
+		c, err := cancelAppointmentTx(ctx, tx, a, terms)
+		if err != nil {
+			return nil, err
+		}
+		canceled = append(canceled, c)
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE series SET canceled_ts = ? WHERE id = ? AND canceled_ts IS NULL`, time.Now().Unix(), seriesID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, errors.New("series not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return canceled, nil
+}
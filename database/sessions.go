@@ -0,0 +1,46 @@
+package database
+
+import "database/sql"
+
+// GetSession возвращает сохранённое состояние диалога (JSON).
+// Истёкшая сессия считается отсутствующей.
+func GetSession(db *sql.DB, chatID int64, nowTS int64) (string, bool, error) {
+	var data string
+	err := db.QueryRow(`
+		SELECT data
+		FROM sessions
+		WHERE chat_id = ? AND expires_ts > ?
+	`, chatID, nowTS).Scan(&data)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return data, true, nil
+}
+
+func SaveSession(db *sql.DB, chatID int64, data string, nowTS int64, expiresTS int64) error {
+	_, err := db.Exec(`
+		INSERT INTO sessions(chat_id, data, updated_ts, expires_ts) VALUES(?, ?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			data = excluded.data,
+			updated_ts = excluded.updated_ts,
+			expires_ts = excluded.expires_ts
+	`, chatID, data, nowTS, expiresTS)
+	return err
+}
+
+func DeleteSession(db *sql.DB, chatID int64) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE chat_id = ?`, chatID)
+	return err
+}
+
+// DeleteExpiredSessions удаляет брошенные сессии, возвращает сколько удалено
+func DeleteExpiredSessions(db *sql.DB, nowTS int64) (int64, error) {
+	res, err := db.Exec(`DELETE FROM sessions WHERE expires_ts <= ?`, nowTS)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
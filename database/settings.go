@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// querier — общее у *sql.DB и *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// GetUserSettings возвращает настройки напоминаний (или значения по умолчанию, если их ещё нет)
+func GetUserSettings(db *sql.DB, chatID int64) (UserSettings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return getUserSettingsTx(ctx, db, chatID)
+}
+
+// SaveUserSettings сохраняет настройки и пересобирает очередь напоминаний
+// для уже существующих будущих записей ученика.
+func SaveUserSettings(db *sql.DB, chatID int64, s UserSettings) error {
+	before := s.Leads()
+
+	// remind_before_min — ближайшее время, как и до выбора нескольких
+	first := defaultUserSettings.RemindBeforeMin
+	if len(before) > 0 {
+		first = before[0]
+	}
+	enabled := 0
+	if s.RemindersEnabled {
+		enabled = 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_settings (chat_id, reminders_enabled, remind_before_min) VALUES (?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			reminders_enabled = excluded.reminders_enabled,
+			remind_before_min = excluded.remind_before_min
+	`, chatID, enabled, first)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_reminder_offsets WHERE chat_id = ?`, chatID); err != nil {
+		return err
+	}
+	for _, m := range before {
+		_, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO user_reminder_offsets (chat_id, before_min) VALUES (?, ?)
+		`, chatID, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rescheduleStudentRemindersTx(ctx, tx, chatID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,6 +1,9 @@
 package database
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
 
 func GetStudentName(db *sql.DB, chatID int64) (string, bool, error) {
 	var name string
@@ -21,3 +24,87 @@ func UpsertStudentName(db *sql.DB, chatID int64, name string) error {
 	`, chatID, name)
 	return err
 }
+
+// SetStudentActive помечает ученика активным/неактивным (неактивный — заблокировал бота).
+// Пишет только если статус действительно меняется; возвращает true в этом случае.
+func SetStudentActive(db *sql.DB, chatID int64, active bool) (bool, error) {
+	v := 0
+	if active {
+		v = 1
+	}
+	res, err := db.Exec(`UPDATE students SET active = ? WHERE chat_id = ? AND active != ?`, v, chatID, v)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Student — ученик из таблицы students
+type Student struct {
+	ChatID      int64 // у ученика без Telegram — ключ из своего диапазона (см. CreatePlaceholderStudent)
+	Name        string
+	Active      bool
+	Placeholder bool // ученик без Telegram: писать ему некуда
+}
+
+// placeholderKeyBase — с него начинаются ключи учеников без Telegram.
+// Bot API обещает, что id чатов (и личных, и групп) укладываются в 52 бита,
+// поэтому такой ключ не совпадёт ни с одним настоящим чатом.
+const placeholderKeyBase int64 = 1 << 53
+
+// IsPlaceholderStudent — chatID принадлежит ученику без Telegram, которого завёл преподаватель
+func IsPlaceholderStudent(db *sql.DB, chatID int64) (bool, error) {
+	return isPlaceholderStudent(context.Background(), db, chatID)
+}
+
+func isPlaceholderStudent(ctx context.Context, q querier, chatID int64) (bool, error) {
+	var placeholder bool
+	err := q.QueryRowContext(ctx, `SELECT placeholder FROM students WHERE chat_id = ?`, chatID).Scan(&placeholder)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return placeholder, err
+}
+
+// GetStudents — ученики по алфавиту, которых может записать преподаватель teacherID:
+// все ученики с Telegram и только его собственные ученики без Telegram
+func GetStudents(db *sql.DB, teacherID int64) ([]Student, error) {
+	rows, err := db.Query(`
+		SELECT chat_id, name, active, placeholder
+		FROM students
+		WHERE placeholder = 0 OR owner_teacher_id = ?
+		ORDER BY name COLLATE NOCASE, chat_id
+	`, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Student
+	for rows.Next() {
+		var s Student
+		if err := rows.Scan(&s.ChatID, &s.Name, &s.Active, &s.Placeholder); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// CreatePlaceholderStudent заводит преподавателю teacherID ученика без Telegram и возвращает
+// его ключ (он же chat_id в записях): следующий свободный, начиная с placeholderKeyBase
+func CreatePlaceholderStudent(db *sql.DB, teacherID int64, name string) (int64, error) {
+	res, err := db.Exec(`
+	INSERT INTO students(chat_id, name, placeholder, owner_teacher_id)
+	SELECT COALESCE(MAX(chat_id), ?) + 1, ?, 1, ? FROM students WHERE chat_id >= ?
+	`, placeholderKeyBase-1, name, teacherID, placeholderKeyBase)
+	if err != nil {
+		return 0, err
+	}
+	// chat_id — INTEGER PRIMARY KEY, то есть rowid
+	return res.LastInsertId()
+}
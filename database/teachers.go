@@ -2,20 +2,30 @@ package database
 
 import (
 	"database/sql"
+	"time"
 )
 
 type Teacher struct {
 	ID           int64
 	Login        string
 	PasswordHash string
+	Name         string
+}
+
+// DisplayName — как преподаватель называется у учеников
+func (t Teacher) DisplayName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Login
 }
 
 func GetTeacherByLogin(db *sql.DB, login string) (Teacher, bool, error) {
 	var t Teacher
 	err := db.QueryRow(
-		`SELECT id, login, password_hash FROM teachers WHERE login = ?`,
+		`SELECT id, login, password_hash, name FROM teachers WHERE login = ?`,
 		login,
-	).Scan(&t.ID, &t.Login, &t.PasswordHash)
+	).Scan(&t.ID, &t.Login, &t.PasswordHash, &t.Name)
 
 	if err == sql.ErrNoRows {
 		return Teacher{}, false, nil
@@ -26,10 +36,122 @@ func GetTeacherByLogin(db *sql.DB, login string) (Teacher, bool, error) {
 	return t, true, nil
 }
 
+// UpsertTeacher добавляет преподавателя (или меняет пароль существующему).
+// Новому сразу задаётся рабочее время по умолчанию, иначе к нему нельзя записаться.
 func UpsertTeacher(db *sql.DB, login, passwordHash string) error {
 	_, err := db.Exec(`
 		INSERT INTO teachers(login, password_hash) VALUES(?, ?)
 		ON CONFLICT(login) DO UPDATE SET password_hash = excluded.password_hash
 	`, login, passwordHash)
+	if err != nil {
+		return err
+	}
+	return seedWorkingHours(db)
+}
+
+// SetTeacherName задаёт имя, которое видят ученики при выборе преподавателя
+func SetTeacherName(db *sql.DB, login, name string) error {
+	_, err := db.Exec(`UPDATE teachers SET name = ? WHERE login = ?`, name, login)
 	return err
 }
+
+// setPrimaryTeacher делает преподавателя login основным (остальные перестают им быть):
+// он первый в списке у учеников, ему достаются записи из базы до нескольких преподавателей.
+// Логина нет — ничего не меняет.
+func setPrimaryTeacher(db *sql.DB, login string) error {
+	_, err := db.Exec(`
+		UPDATE teachers SET is_primary = (login = ?)
+		WHERE EXISTS (SELECT 1 FROM teachers WHERE login = ?)
+	`, login, login)
+	return err
+}
+
+// GetTeachers возвращает всех преподавателей (основной — первым)
+func GetTeachers(db *sql.DB) ([]Teacher, error) {
+	rows, err := db.Query(`SELECT id, login, password_hash, name FROM teachers ORDER BY is_primary DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Teacher
+	for rows.Next() {
+		var t Teacher
+		if err := rows.Scan(&t.ID, &t.Login, &t.PasswordHash, &t.Name); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// GetTeacher возвращает преподавателя по id
+func GetTeacher(db *sql.DB, id int64) (Teacher, bool, error) {
+	var t Teacher
+	err := db.QueryRow(
+		`SELECT id, login, password_hash, name FROM teachers WHERE id = ?`,
+		id,
+	).Scan(&t.ID, &t.Login, &t.PasswordHash, &t.Name)
+
+	if err == sql.ErrNoRows {
+		return Teacher{}, false, nil
+	}
+	if err != nil {
+		return Teacher{}, false, err
+	}
+	return t, true, nil
+}
+
+type TeacherSession struct {
+	ChatID    int64
+	TeacherID int64
+	ExpiresTS int64
+}
+
+// CreateTeacherSession запоминает, что в чате chatID вошёл преподаватель teacherID.
+// Чаты преподавателя хранятся только здесь: выход удаляет сессию, и писать туда перестаём.
+func CreateTeacherSession(db *sql.DB, teacherID int64, chatID int64, expiresTS int64) error {
+	_, err := db.Exec(`
+		INSERT INTO teacher_sessions(chat_id, teacher_id, created_ts, expires_ts) VALUES(?, ?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			teacher_id = excluded.teacher_id,
+			created_ts = excluded.created_ts,
+			expires_ts = excluded.expires_ts
+	`, chatID, teacherID, time.Now().Unix(), expiresTS)
+	return err
+}
+
+// ExtendTeacherSession продлевает сессию (преподаватель пользуется ботом)
+func ExtendTeacherSession(db *sql.DB, chatID int64, expiresTS int64) error {
+	_, err := db.Exec(`UPDATE teacher_sessions SET expires_ts = ? WHERE chat_id = ?`, expiresTS, chatID)
+	return err
+}
+
+// DeleteTeacherSession — выход преподавателя на этом устройстве
+func DeleteTeacherSession(db *sql.DB, chatID int64) error {
+	_, err := db.Exec(`DELETE FROM teacher_sessions WHERE chat_id = ?`, chatID)
+	return err
+}
+
+// GetTeacherSessions удаляет истёкшие сессии и возвращает оставшиеся
+func GetTeacherSessions(db *sql.DB, nowTS int64) ([]TeacherSession, error) {
+	if _, err := db.Exec(`DELETE FROM teacher_sessions WHERE expires_ts <= ?`, nowTS); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT chat_id, teacher_id, expires_ts FROM teacher_sessions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []TeacherSession
+	for rows.Next() {
+		var s TeacherSession
+		if err := rows.Scan(&s.ChatID, &s.TeacherID, &s.ExpiresTS); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WaitAnyTime — в листе ожидания: подойдёт любое время в этот день
+const WaitAnyTime = -1
+
+// WaitlistEntry — ученик ждёт, когда освободится время у преподавателя
+type WaitlistEntry struct {
+	ID             int64
+	TeacherID      int64
+	StudentChatID  int64
+	StudentName    string
+	Date           string // "YYYY-MM-DD"
+	StartMin       int    // минуты от полуночи по Москве; WaitAnyTime — любое время
+	DurationMin    int
+	CreatedTS      int64
+	OfferStartTS   int64 // предложенное время; 0 — ничего не предложено
+	OfferExpiresTS int64 // до какого момента предложение в силе
+}
+
+const waitlistColumns = `id, teacher_id, student_chat_id, student_name, date, start_min, duration_min, created_ts, offer_start_ts, offer_expires_ts`
+
+func scanWaitlist(rows *sql.Rows) ([]WaitlistEntry, error) {
+	var res []WaitlistEntry
+	for rows.Next() {
+		var e WaitlistEntry
+		if err := rows.Scan(
+			&e.ID,
+			&e.TeacherID,
+			&e.StudentChatID,
+			&e.StudentName,
+			&e.Date,
+			&e.StartMin,
+			&e.DurationMin,
+			&e.CreatedTS,
+			&e.OfferStartTS,
+			&e.OfferExpiresTS,
+		); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+func queryWaitlist(db *sql.DB, where string, args ...interface{}) ([]WaitlistEntry, error) {
+	rows, err := db.Query(`SELECT `+waitlistColumns+` FROM waitlist WHERE `+where+` ORDER BY created_ts, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanWaitlist(rows)
+}
+
+// JoinWaitlist ставит ученика в лист ожидания и возвращает id записи в нём.
+// Повторная постановка на то же время не создаёт дубль и не сдвигает очередь,
+// но меняет длительность; предложение на прежнюю длительность при этом снимается.
+func JoinWaitlist(db *sql.DB, e WaitlistEntry) (int64, error) {
+	_, err := db.Exec(`
+		INSERT INTO waitlist (teacher_id, student_chat_id, student_name, date, start_min, duration_min, created_ts)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (teacher_id, student_chat_id, date, start_min) DO UPDATE SET
+			offer_start_ts = CASE WHEN duration_min = excluded.duration_min THEN offer_start_ts ELSE 0 END,
+			offer_expires_ts = CASE WHEN duration_min = excluded.duration_min THEN offer_expires_ts ELSE 0 END,
+			duration_min = excluded.duration_min
+	`, e.TeacherID, e.StudentChatID, e.StudentName, e.Date, e.StartMin, e.DurationMin, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = db.QueryRow(`
+		SELECT id FROM waitlist
+		WHERE teacher_id = ? AND student_chat_id = ? AND date = ? AND start_min = ?
+	`, e.TeacherID, e.StudentChatID, e.Date, e.StartMin).Scan(&id)
+	return id, err
+}
+
+// GetWaitlistEntry возвращает запись листа ожидания по id
+func GetWaitlistEntry(db *sql.DB, id int64) (WaitlistEntry, bool, error) {
+	list, err := queryWaitlist(db, `id = ?`, id)
+	if err != nil || len(list) == 0 {
+		return WaitlistEntry{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// GetDayWaitlist — очередь ожидающих у преподавателя на дату, первыми — давно ждущие
+func GetDayWaitlist(db *sql.DB, teacherID int64, date string) ([]WaitlistEntry, error) {
+	return queryWaitlist(db, `teacher_id = ? AND date = ?`, teacherID, date)
+}
+
+// GetExpiredWaitlistOffers — предложения, на которые ученик не ответил вовремя
+func GetExpiredWaitlistOffers(db *sql.DB, nowTS int64) ([]WaitlistEntry, error) {
+	return queryWaitlist(db, `offer_expires_ts > 0 AND offer_expires_ts <= ?`, nowTS)
+}
+
+// GetHeldWaitlistOffers — действующие предложения у преподавателя на время, начинающееся
+// в [fromTS, toTS), кроме предложений ученику exceptChatID: это время держится за другими
+func GetHeldWaitlistOffers(db *sql.DB, teacherID int64, fromTS int64, toTS int64, exceptChatID int64) ([]WaitlistEntry, error) {
+	return queryWaitlist(db, `teacher_id = ? AND offer_expires_ts > ? AND offer_start_ts >= ? AND offer_start_ts < ? AND student_chat_id != ?`,
+		teacherID, time.Now().Unix(), fromTS, toTS, exceptChatID)
+}
+
+// checkWaitlistOffersTx — ErrSlotBusy, если [startTS, endTS) задевает время, предложенное
+// из листа ожидания кому-то кроме studentChatID, и предложение ещё в силе
+func checkWaitlistOffersTx(ctx context.Context, tx *sql.Tx, teacherID int64, studentChatID int64, startTS int64, endTS int64) error {
+	var cnt int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(1)
+		FROM waitlist
+		WHERE teacher_id = ? AND student_chat_id != ? AND offer_expires_ts > ?
+		  AND offer_start_ts < ? AND offer_start_ts + duration_min*60 > ?;
+	`, teacherID, studentChatID, time.Now().Unix(), endTS, startTS).Scan(&cnt)
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return ErrSlotBusy
+	}
+	return nil
+}
+
+// OfferWaitlistSlot отмечает, что ученику предложено время startTS до expiresTS.
+// false — у него уже есть действующее предложение (или записи больше нет).
+func OfferWaitlistSlot(db *sql.DB, id int64, startTS int64, expiresTS int64) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE waitlist
+		SET offer_start_ts = ?, offer_expires_ts = ?
+		WHERE id = ? AND offer_expires_ts <= ?
+	`, startTS, expiresTS, id, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ClearWaitlistOffer снимает предложение: ученик остаётся в очереди
+func ClearWaitlistOffer(db *sql.DB, id int64) error {
+	_, err := db.Exec(`UPDATE waitlist SET offer_start_ts = 0, offer_expires_ts = 0 WHERE id = ?`, id)
+	return err
+}
+
+// LeaveWaitlist убирает ученика из листа ожидания (только его собственную запись)
+func LeaveWaitlist(db *sql.DB, id int64, chatID int64) error {
+	_, err := db.Exec(`DELETE FROM waitlist WHERE id = ? AND student_chat_id = ?`, id, chatID)
+	return err
+}
+
+// DeleteWaitlistEntry убирает запись листа ожидания (предложение истекло или принято)
+func DeleteWaitlistEntry(db *sql.DB, id int64) error {
+	_, err := db.Exec(`DELETE FROM waitlist WHERE id = ?`, id)
+	return err
+}
+
+// DeletePastWaitlist убирает ожидание на прошедшие дни (date раньше today, "YYYY-MM-DD")
+func DeletePastWaitlist(db *sql.DB, today string) error {
+	_, err := db.Exec(`DELETE FROM waitlist WHERE date < ?`, today)
+	return err
+}
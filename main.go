@@ -2,6 +2,7 @@ package main
 
 import (
 	"bot/service"
+	"bot/telegram"
 	"fmt"
 	"os"
 )
@@ -12,8 +13,14 @@ func main() {
 		fmt.Println("TOKEN is not set")
 		return
 	}
+	tg := telegram.NewClient(token)
+	// свой Bot API сервер (или локальная заглушка)
+	if apiURL := os.Getenv("TELEGRAM_API_URL"); apiURL != "" {
+		tg.BaseURL = apiURL
+	}
+
 	println("Start!")
-	if err := service.StartBot(token); err != nil {
+	if err := service.StartBot(tg, service.ConfigFromEnv()); err != nil {
 		fmt.Println("Error starting bot:", err)
 	}
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"database/sql"
+	"log/slog"
+	"sync"
+)
+
+// activeChats — чаты, которые уже отмечены активными с запуска бота: чтобы не писать
+// в students на каждое обновление. Ошибка «заблокировал бота» убирает чат отсюда.
+var activeChats sync.Map
+
+// markIfBlocked проверяет ошибку отправки: если пользователь заблокировал бота,
+// помечает ученика неактивным, чтобы напоминания и рассылки его больше не трогали.
+// Возвращает true, если это именно такая ошибка.
+func markIfBlocked(db *sql.DB, chatID int64, err error) bool {
+	if !telegram.IsBlockedByUser(err) {
+		return false
+	}
+	activeChats.Delete(chatID)
+	if changed, err := database.SetStudentActive(db, chatID, false); err != nil {
+		slog.Error("mark student inactive error", "chat_id", chatID, "err", err)
+	} else if changed {
+		slog.Info("student blocked the bot", "chat_id", chatID)
+	}
+	return true
+}
+
+// markActive — пользователь снова пишет боту, значит он его не блокирует.
+// В базу идём только в первый раз с запуска или после блокировки.
+func markActive(db *sql.DB, chatID int64) {
+	if _, ok := activeChats.Load(chatID); ok {
+		return
+	}
+	changed, err := database.SetStudentActive(db, chatID, true)
+	if err != nil {
+		slog.Error("mark student active error", "chat_id", chatID, "err", err)
+		return
+	}
+	activeChats.Store(chatID, struct{}{})
+	if changed {
+		slog.Info("student is active again", "chat_id", chatID)
+	}
+}
+
+// handleMyChatMember — Telegram сообщает, что бота заблокировали ("kicked") или разблокировали
+func handleMyChatMember(db *sql.DB, upd *telegram.ChatMemberUpdated) {
+	switch upd.NewChatMember.Status {
+	case "kicked":
+		activeChats.Delete(upd.Chat.ID)
+		if _, err := database.SetStudentActive(db, upd.Chat.ID, false); err != nil {
+			slog.Error("mark student inactive error", "chat_id", upd.Chat.ID, "err", err)
+		}
+		if _, ok := teacherChats.get(upd.Chat.ID); ok {
+			logoutTeacher(db, upd.Chat.ID)
+		}
+		slog.Info("bot blocked by user", "chat_id", upd.Chat.ID)
+	case "member":
+		markActive(db, upd.Chat.ID)
+	}
+}
+
+// isPlaceholder — ученик без Telegram. Если база не ответила, считаем обычным:
+// отправка в несуществующий чат просто не пройдёт
+func isPlaceholder(db *sql.DB, chatID int64) bool {
+	placeholder, err := database.IsPlaceholderStudent(db, chatID)
+	if err != nil {
+		slog.Error("check placeholder student error", "chat_id", chatID, "err", err)
+	}
+	return placeholder
+}
+
+// notifyStudent пишет ученику chatID; ученику без Telegram писать некуда — пропускаем
+func notifyStudent(tg *telegram.Client, db *sql.DB, chatID int64, text string) {
+	notifyStudentKeyboard(tg, db, chatID, text, nil)
+}
+
+// notifyStudentKeyboard — то же с кнопками под сообщением (nil — без кнопок)
+func notifyStudentKeyboard(tg *telegram.Client, db *sql.DB, chatID int64, text string, kb *telegram.InlineKeyboardMarkup) {
+	if isPlaceholder(db, chatID) {
+		return
+	}
+	var err error
+	if kb == nil {
+		err = tg.SendMessage(chatID, text)
+	} else {
+		err = tg.SendMessageInlineKeyboard(chatID, text, kb)
+	}
+	if err != nil && !markIfBlocked(db, chatID, err) {
+		slog.Error("notify student send failed", "chat_id", chatID, "err", err)
+	}
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blockedInputRe: "31.12.2026", "31.12.2026-08.01.2027", "20.11.2026 13:00-14:00",
+// "18.11.2026 13-14 каждую неделю", "31.12.2026-08.01.2027 каждый год"
+var blockedInputRe = regexp.MustCompile(`^(\d{1,2}\.\d{1,2}\.\d{4})(?:\s*-\s*(\d{1,2}\.\d{1,2}\.\d{4}))?(?:\s+(\d{1,2}(?:[:.]\d{2})?\s*-\s*\d{1,2}(?:[:.]\d{2})?))?(?:\s+(каждую неделю|каждый год))?$`)
+
+const blockedInputHelp = "Введите даты и, если нужно, время, например:\n" +
+	"31.12.2026 — весь день\n" +
+	"01.07.2027-14.07.2027 — отпуск\n" +
+	"20.11.2026 13:00-14:00 — окно в этот день\n" +
+	"16.11.2026-20.11.2026 13:00-14:00 каждую неделю — перерыв Пн–Пт\n" +
+	"31.12.2026-08.01.2027 каждый год — праздники"
+
+// parseBlockedPeriod разбирает ввод преподавателя; problem != "" — почему не вышло
+func parseBlockedPeriod(s string, now time.Time) (p database.BlockedPeriod, problem string) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer("—", "-", "–", "-").Replace(s)
+	m := blockedInputRe.FindStringSubmatch(s)
+	if m == nil {
+		return p, "Не понял.\n\n" + blockedInputHelp
+	}
+
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	from, err := time.ParseInLocation("2.1.2006", m[1], loc)
+	if err != nil {
+		return p, "Неверная дата: " + m[1]
+	}
+	to := from
+	if m[2] != "" {
+		if to, err = time.ParseInLocation("2.1.2006", m[2], loc); err != nil {
+			return p, "Неверная дата: " + m[2]
+		}
+	}
+	if to.Before(from) {
+		return p, "Конец периода раньше начала"
+	}
+
+	p.FromDate = from.Format("2006-01-02")
+	p.ToDate = to.Format("2006-01-02")
+	p.StartMin, p.EndMin = 0, 24*60
+	if m[3] != "" {
+		h, ok := parseWorkingHours(m[3])
+		if !ok || h.DayOff {
+			return p, "Неверное время. Пример: 13:00-14:00 (минуты только 00 или 30)"
+		}
+		p.StartMin, p.EndMin = h.StartMin, h.EndMin
+	}
+
+	days := int(to.Sub(from).Hours() / 24)
+	switch m[4] {
+	case "каждую неделю":
+		p.Repeat = database.BlockWeekly
+		if days > 6 {
+			return p, "Для повтора каждую неделю период — не больше 7 дней"
+		}
+	case "каждый год":
+		p.Repeat = database.BlockYearly
+		if days > 364 {
+			return p, "Для повтора каждый год период — меньше года"
+		}
+	default:
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		if to.Before(today) {
+			return p, "Этот период уже прошёл"
+		}
+	}
+	return p, ""
+}
+
+// blockedLabel: "31.12.2026–08.01.2027, весь день", "Пн–Пт 13:00–14:00, каждую неделю с 16.11.2026"
+func blockedLabel(p database.BlockedPeriod) string {
+	window := "весь день"
+	if !p.WholeDay() {
+		window = clockLabel(p.StartMin) + "–" + clockLabel(p.EndMin)
+	}
+
+	from, err1 := time.Parse("2006-01-02", p.FromDate)
+	to, err2 := time.Parse("2006-01-02", p.ToDate)
+	if err1 != nil || err2 != nil {
+		return p.FromDate + "–" + p.ToDate + ", " + window
+	}
+
+	switch p.Repeat {
+	case database.BlockWeekly:
+		days := weekdayShort[from.Weekday()]
+		if !to.Equal(from) {
+			days += "–" + weekdayShort[to.Weekday()]
+		}
+		return days + " " + window + ", каждую неделю с " + from.Format("02.01.2006")
+	case database.BlockYearly:
+		dates := from.Format("02.01")
+		if !to.Equal(from) {
+			dates += "–" + to.Format("02.01")
+		}
+		return dates + ", " + window + ", каждый год"
+	}
+
+	dates := from.Format("02.01.2006")
+	if !to.Equal(from) {
+		dates += "–" + to.Format("02.01.2006")
+	}
+	return dates + ", " + window
+}
+
+func blockedPeriodsText(periods database.BlockedPeriods) string {
+	var b strings.Builder
+	b.WriteString("⛔ Отпуск и перерывы\n")
+	if len(periods) == 0 {
+		b.WriteString("\nПока ничего не закрыто.")
+	}
+	for _, p := range periods {
+		b.WriteString("\n• " + blockedLabel(p))
+	}
+	b.WriteString("\n\nВ это время записаться к вам нельзя. 📋 — занятия, которые уже попали в период, ❌ — открыть время снова.")
+	return b.String()
+}
+
+// BlockedPeriodsKeyboard: bp:apps:<id>, bp:del:<id>, bp:add
+func BlockedPeriodsKeyboard(periods database.BlockedPeriods) *telegram.InlineKeyboardMarkup {
+	var rows [][]telegram.InlineKeyboardButton
+	for _, p := range periods {
+		id := strconv.FormatInt(p.ID, 10)
+		rows = append(rows, []telegram.InlineKeyboardButton{
+			{Text: "📋 " + blockedLabel(p), CallbackData: "bp:apps:" + id},
+			{Text: "❌", CallbackData: "bp:del:" + id},
+		})
+	}
+	rows = append(rows, []telegram.InlineKeyboardButton{
+		{Text: "➕ Закрыть время", CallbackData: "bp:add"},
+	})
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// loadBlockedPeriods читает действующие периоды вошедшего преподавателя
+func loadBlockedPeriods(c *Ctx) (database.BlockedPeriods, bool) {
+	today := time.Now().In(time.FixedZone("Europe/Moscow", 3*3600)).Format("2006-01-02")
+	periods, err := database.GetBlockedPeriods(c.DB, currentTeacherID(c.ChatID), today)
+	if err != nil {
+		slog.Error("get blocked periods error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return nil, false
+	}
+	return periods, true
+}
+
+// «Отпуск и перерывы» — меню преподавателя
+func handleBlockedPeriods(c *Ctx) {
+	periods, ok := loadBlockedPeriods(c)
+	if !ok {
+		return
+	}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, blockedPeriodsText(periods), BlockedPeriodsKeyboard(periods))
+}
+
+// bp:add / bp:del:<id> / bp:apps:<id> / bp:cancel:<id> / bp:cancel_yes:<id> / bp:keep
+func handleBlockedPeriodsCallback(c *Ctx) {
+	parts := strings.Split(c.Data, ":")
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "add":
+			c.Sess.TeacherStatus = "bp_add"
+			_ = c.TG.SendMessage(c.ChatID, blockedInputHelp+"\n\nили «отмена».")
+		case "keep":
+			_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Занятия сохранены", nil)
+		}
+		return
+	}
+	if len(parts) != 3 {
+		return
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return
+	}
+
+	if parts[1] == "del" {
+		if _, err := database.DeleteBlockedPeriod(c.DB, id, currentTeacherID(c.ChatID)); err != nil {
+			slog.Error("delete blocked period error", "id", id, "err", err)
+			_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+			return
+		}
+		// обновляем то же меню, а не присылаем новое
+		periods, ok := loadBlockedPeriods(c)
+		if !ok {
+			return
+		}
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, blockedPeriodsText(periods), BlockedPeriodsKeyboard(periods))
+		return
+	}
+
+	p, apps, ok := blockedTarget(c, id)
+	if !ok {
+		return
+	}
+	switch parts[1] {
+	case "apps":
+		sendBlockedAppointments(c, p, apps)
+	case "cancel":
+		if len(apps) == 0 {
+			_ = c.TG.SendMessage(c.ChatID, "В этом периоде нет занятий")
+			return
+		}
+		kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{
+			{{Text: "✅ Да, отменить все", CallbackData: "bp:cancel_yes:" + parts[2]}},
+			{{Text: "Нет, оставить", CallbackData: "bp:keep"}},
+		}}
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Отменить занятия в период «"+blockedLabel(p)+"»: "+
+			strconv.Itoa(len(apps))+"?\nУченики получат уведомление.", kb)
+	case "cancel_yes":
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, c.MsgID, nil)
+		cancelBlockedAppointments(c, apps)
+	}
+}
+
+// blockedTarget — период id вошедшего преподавателя и уже попавшие в него будущие занятия
+func blockedTarget(c *Ctx, id int64) (database.BlockedPeriod, []database.Appointment, bool) {
+	p, ok, err := database.GetBlockedPeriod(c.DB, id)
+	if err != nil {
+		slog.Error("get blocked period error", "id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return p, nil, false
+	}
+	if !ok || p.TeacherID != currentTeacherID(c.ChatID) {
+		_ = c.TG.SendMessage(c.ChatID, "Период не найден: его уже удалили")
+		return p, nil, false
+	}
+	apps, err := database.GetBlockedAppointments(c.DB, p)
+	if err != nil {
+		slog.Error("get blocked appointments error", "id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return p, nil, false
+	}
+	return p, apps, true
+}
+
+// sendBlockedAppointments — занятия в периоде p: по одному отменить (❌ — как в «Записи по дням») или все сразу
+func sendBlockedAppointments(c *Ctx, p database.BlockedPeriod, apps []database.Appointment) {
+	if len(apps) == 0 {
+		_ = c.TG.SendMessage(c.ChatID, "В период «"+blockedLabel(p)+"» занятий нет")
+		return
+	}
+
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	var rows [][]telegram.InlineKeyboardButton
+	for _, a := range apps {
+		date := time.Unix(a.StartTS, 0).In(loc).Format("2006-01-02")
+		rows = append(rows, []telegram.InlineKeyboardButton{{
+			Text:         "❌ " + moveWhen(a.StartTS) + " — " + a.StudentName,
+			CallbackData: "t_cancel_app:" + strconv.FormatInt(a.ID, 10) + ":" + date,
+		}})
+	}
+	rows = append(rows, []telegram.InlineKeyboardButton{
+		{Text: "❌ Отменить все (" + strconv.Itoa(len(apps)) + ")", CallbackData: "bp:cancel:" + strconv.FormatInt(p.ID, 10)},
+	})
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, "Занятия в период «"+blockedLabel(p)+"»:", &telegram.InlineKeyboardMarkup{InlineKeyboard: rows})
+}
+
+// cancelBlockedAppointments отменяет занятия преподавателем и сообщает ученикам.
+// Освободившееся время никому не предлагаем: оно закрыто.
+func cancelBlockedAppointments(c *Ctx, apps []database.Appointment) {
+	terms := teacherCancelTerms()
+	terms.Reason = "преподаватель недоступен"
+
+	n := 0
+	for _, a := range apps {
+		canceled, err := database.CancelAppointmentTx(c.DB, a, terms)
+		if err == database.ErrAppointmentChanged {
+			continue
+		}
+		if err != nil {
+			slog.Error("cancel appointment error", "appointment_id", a.ID, "err", err)
+			continue
+		}
+		notifyCancelStudent(c.TG, c.DB, canceled)
+		n++
+	}
+	text := "✅ Отменено занятий: " + strconv.Itoa(n)
+	if n < len(apps) {
+		text += " из " + strconv.Itoa(len(apps)) + " (остальные уже изменились или не отменились — проверьте «Записи по дням»)"
+	}
+	_ = c.TG.SendMessage(c.ChatID, text)
+}
+
+// шаг bp_add
+func handleBlockedPeriodInput(c *Ctx) {
+	p, problem := parseBlockedPeriod(c.Text, time.Now().In(time.FixedZone("Europe/Moscow", 3*3600)))
+	if problem != "" {
+		_ = c.TG.SendMessage(c.ChatID, problem)
+		return
+	}
+	p.TeacherID = currentTeacherID(c.ChatID)
+
+	id, err := database.AddBlockedPeriod(c.DB, p)
+	if err == database.ErrInvalidBlockedPeriod {
+		_ = c.TG.SendMessage(c.ChatID, "Такой период сохранить нельзя.\n\n"+blockedInputHelp)
+		return
+	}
+	if err != nil {
+		slog.Error("add blocked period error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+		return
+	}
+	c.Sess.TeacherStatus = ""
+	p.ID = id
+
+	apps, err := database.GetBlockedAppointments(c.DB, p)
+	if err != nil {
+		slog.Error("get blocked appointments error", "id", id, "err", err)
+	}
+	if len(apps) == 0 {
+		_ = c.TG.SendMessage(c.ChatID, "✅ Закрыто: "+blockedLabel(p))
+		handleBlockedPeriods(c)
+		return
+	}
+
+	// на это время уже кто-то записан — новых записей не будет, а старые решает преподаватель
+	_ = c.TG.SendMessage(c.ChatID, "✅ Закрыто: "+blockedLabel(p)+"\n\n❗ На это время уже записаны ученики.")
+	sendBlockedAppointments(c, p, apps)
+}
@@ -0,0 +1,680 @@
+package service
+
+import (
+	calendar "bot/calendarwidget"
+	"bot/database"
+	"bot/telegram"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleBookingStart — «Записаться»: выбор преподавателя (если их несколько) или сразу календарь
+func handleBookingStart(c *Ctx) {
+	st := &c.Sess.Booking
+
+	// прошлая незавершённая запись — убираем её клавиатуру
+	if st.MsgID != 0 {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, st.MsgID, nil)
+		st.MsgID = 0
+	}
+
+	st.Step = "pick_tutor"
+	st.TeacherID = 0
+	st.Date = ""
+	st.Time = ""
+	st.DurationMin = 0
+	st.Repeat = ""
+	st.MoveID = 0
+	st.MoveFromTS = 0
+	st.MoveByTeacher = false
+	st.ForChatID = 0
+	st.ForName = ""
+
+	teachers, err := database.GetTeachers(c.DB)
+	if err != nil {
+		slog.Error("get teachers error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+
+	var mid int
+	switch len(teachers) {
+	case 0:
+		c.Sess.Booking = BookingState{}
+		_ = c.TG.SendMessage(c.ChatID, "Пока записаться не к кому: нет ни одного преподавателя.")
+		return
+	case 1:
+		// выбирать не из кого — сразу календарь
+		st.TeacherID = teachers[0].ID
+		st.Step = "pick_date"
+		mid, err = c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, "Выберите дату:", tutorCalendar(c, st.TeacherID))
+	default:
+		mid, err = c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, "Выберите преподавателя:", TutorKeyboard(teachers))
+	}
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+// tutor:<teacher_id>
+func handleTutorPick(c *Ctx) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(c.Data, "tutor:"), 10, 64)
+	if err != nil {
+		return
+	}
+	t, ok, err := database.GetTeacher(c.DB, id)
+	if err != nil {
+		slog.Error("get teacher error", "teacher_id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok {
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Этого преподавателя больше нет. Нажмите «Записаться» ещё раз.", nil)
+		return
+	}
+
+	st := &c.Sess.Booking
+	st.TeacherID = t.ID
+	st.Step = "pick_date"
+	st.MsgID = c.MsgID
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Преподаватель: "+t.DisplayName()+"\nВыберите дату:", tutorCalendar(c, t.ID))
+}
+
+// шаг pick_tutor: преподаватель выбирается только кнопками — присылаем их ещё раз
+func handleTutorInput(c *Ctx) {
+	teachers, err := database.GetTeachers(c.DB)
+	if err != nil {
+		slog.Error("get teachers error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, "Выберите преподавателя:", TutorKeyboard(teachers))
+	if err == nil {
+		c.Sess.Booking.MsgID = mid
+	}
+}
+
+// tutorCalendar — календарь записи к преподавателю на текущий месяц
+func tutorCalendar(c *Ctx, teacherID int64) *telegram.InlineKeyboardMarkup {
+	now := time.Now().In(time.FixedZone("Europe/Moscow", 3*3600))
+	cal := bookingCalendar(c, bookingPurpose(teacherID), teacherID, now.Year(), now.Month())
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: cal.GetKeyboard()}
+}
+
+// handleBookingAbort — «нет» / «отмена» текстом
+func handleBookingAbort(c *Ctx) {
+	if strings.HasPrefix(c.Sess.TeacherStatus, "wh_") {
+		c.Sess.TeacherStatus = ""
+		_ = c.TG.SendMessage(c.ChatID, "Ок, рабочее время не меняю.")
+		return
+	}
+	if c.Sess.TeacherStatus == "bp_add" {
+		c.Sess.TeacherStatus = ""
+		_ = c.TG.SendMessage(c.ChatID, "Ок, ничего не закрываю.")
+		return
+	}
+	if c.Sess.TeacherStatus == "t_book_name" {
+		c.Sess.TeacherStatus = ""
+		_ = c.TG.SendMessage(c.ChatID, "Ок, никого не записываю.")
+		return
+	}
+	c.Sess.Booking = BookingState{}
+	_ = c.TG.SendMessage(c.ChatID, "Ок, отменил текущую запись.")
+}
+
+// booking_cancel
+func handleBookingCancel(c *Ctx) {
+	c.Sess.Booking = BookingState{}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Ок, отменил текущую запись.", nil)
+}
+
+// cal:<purpose>:<YYYYMM>:<action>[:arg] — месяц приходит в самой кнопке,
+// поэтому старый календарь работает и после перезапуска бота
+func handleCalendar(c *Ctx) {
+	cb, err := calendar.ParseCallback(c.Data)
+	if err != nil || cb.Action == calendar.ActionNoop {
+		return
+	}
+
+	if cb.Purpose == calTeacherDays {
+		// тот же календарь преподаватель использует для просмотра записей
+		teacherOnly(func(c *Ctx) { handleTeacherCalendar(c, cb) })(c)
+		return
+	}
+	if teacherID, ok := bookingTeacherID(cb.Purpose); ok {
+		handleBookingCalendar(c, cb, teacherID)
+	}
+}
+
+// handleBookingCalendar — нажатие в календаре записи ученика к преподавателю teacherID
+func handleBookingCalendar(c *Ctx, cb calendar.Callback, teacherID int64) {
+	if cb.Action != calendar.ActionDay {
+		editCalendar(c, cb, teacherID)
+		return
+	}
+
+	st := &c.Sess.Booking
+	date := cb.Date().Format("2006-01-02")
+	if st.MoveID != 0 {
+		if st.TeacherID == teacherID {
+			// перенос: длительность уже известна — сразу время
+			st.Date = date
+			st.MsgID = c.MsgID
+			editTimePicker(c, 0)
+			return
+		}
+		// календарь из старого сообщения — это уже новая запись
+		st.MoveID, st.MoveFromTS, st.MoveByTeacher = 0, 0, false
+	}
+	st.TeacherID = teacherID
+	st.Date = date
+
+	// ученик — сначала длительность: от неё зависит, какое время свободно
+	st.Step = "pick_duration"
+	st.Time = ""
+	st.MsgID = c.MsgID
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Вы выбрали: "+date+"\nВыберите длительность:", DurationKeyboard())
+}
+
+// editCalendar листает календарь (или показывает выбор месяца) в том же сообщении
+func editCalendar(c *Ctx, cb calendar.Callback, teacherID int64) {
+	year, month := cb.Target()
+	cal := bookingCalendar(c, cb.Purpose, teacherID, year, month)
+
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: cal.GetKeyboard()}
+	if cb.Action == calendar.ActionMonths {
+		kb.InlineKeyboard = cal.GetMonthPickKeyboard()
+	}
+	_ = c.TG.EditMessageReplyMarkup(c.ChatID, c.MsgID, kb)
+}
+
+// time_page:YYYY-MM-DD:2
+func handleTimePage(c *Ctx) {
+	parts := strings.Split(c.Data, ":")
+	if len(parts) != 3 {
+		return
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return
+	}
+
+	st := &c.Sess.Booking
+	if st.DurationMin == 0 {
+		bookingExpired(c)
+		return
+	}
+	st.Date = parts[1]
+	st.MsgID = c.MsgID
+	editTimePicker(c, page)
+}
+
+// time_cal — вернуться из выбора времени к календарю
+func handleTimeBack(c *Ctx) {
+	st := &c.Sess.Booking
+	if st.TeacherID == 0 {
+		bookingExpired(c)
+		return
+	}
+	st.Step = "pick_date"
+	st.Time = ""
+	st.MsgID = c.MsgID
+
+	// календарь на месяц выбранного дня
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	month, err := time.ParseInLocation("2006-01-02", st.Date, loc)
+	if err != nil {
+		month = time.Now().In(loc)
+	}
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: bookingCalendar(c, bookingPurpose(st.TeacherID), st.TeacherID, month.Year(), month.Month()).GetKeyboard()}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Выберите дату:", kb)
+}
+
+// editTimePicker показывает в сообщении записи время, свободное на st.Date для st.DurationMin
+func editTimePicker(c *Ctx, page int) {
+	st := &c.Sess.Booking
+	slots, err := daySlots(c.DB, st.TeacherID, bookingChatID(c, st), st.Date, st.DurationMin, st.MoveID)
+	if err != nil {
+		slog.Error("get day slots error", "date", st.Date, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+
+	st.Step = "pick_time"
+	text := "Выберите время (" + strconv.Itoa(st.DurationMin) + " мин):"
+	if len(slots) == 0 {
+		text = "На " + st.Date + " свободного времени нет. Выберите другой день."
+	}
+	kb := TimeKeyboard(st.Date, slots, page)
+	if st.MoveID == 0 && st.ForChatID == 0 && len(slots) > 0 && allBusy(slots) {
+		// всё занято — можно подождать, пока кто-нибудь отменит
+		text = "На " + st.Date + " всё занято. Выберите другой день или встаньте в лист ожидания."
+		kb.InlineKeyboard = append(kb.InlineKeyboard, WaitlistKeyboard(st.TeacherID, st.Date, database.WaitAnyTime, st.DurationMin).InlineKeyboard...)
+	}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, kb)
+}
+
+func allBusy(slots []TimeSlot) bool {
+	for _, s := range slots {
+		if !s.Busy {
+			return false
+		}
+	}
+	return true
+}
+
+// bookingExpired — кнопка из старого сообщения, а сессия записи уже сброшена
+func bookingExpired(c *Ctx) {
+	c.Sess.Booking = BookingState{}
+	_ = c.TG.SendMessage(c.ChatID, "Сессия записи устарела или не заполнена. Нажмите «Записаться» ещё раз.")
+}
+
+// time_pick:YYYY-MM-DD:15:30
+func handleTimePick(c *Ctx) {
+	parts := strings.Split(c.Data, ":")
+	if len(parts) != 4 {
+		return
+	}
+
+	st := &c.Sess.Booking
+	if st.DurationMin == 0 {
+		bookingExpired(c)
+		return
+	}
+	st.Date = parts[1]
+	st.Time = parts[2] + ":" + parts[3]
+	st.MsgID = c.MsgID
+
+	text, kb := afterTimeScreen(st)
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, kb)
+}
+
+// afterTimeScreen — следующий шаг после выбора времени: повторы или, при переносе, подтверждение
+func afterTimeScreen(st *BookingState) (string, *telegram.InlineKeyboardMarkup) {
+	if st.MoveID != 0 {
+		st.Step = "confirm"
+		return moveSummary(st), ConfirmKeyboard()
+	}
+	st.Step = "pick_repeat"
+	return bookingSummary(st) + "\nКак записать?", RepeatKeyboard()
+}
+
+// bookingSummary: "Вы выбрали: 2026-11-16 17:30, 60 мин"
+// (при записи преподавателем — с именем ученика в первой строке)
+func bookingSummary(st *BookingState) string {
+	if st.ForChatID != 0 {
+		return "Ученик: " + st.ForName + "\nВы выбрали: " + st.Date + " " + st.Time + ", " + strconv.Itoa(st.DurationMin) + " мин"
+	}
+	return "Вы выбрали: " + st.Date + " " + st.Time + ", " + strconv.Itoa(st.DurationMin) + " мин"
+}
+
+// time_manual:YYYY-MM-DD
+func handleTimeManual(c *Ctx) {
+	parts := strings.Split(c.Data, ":")
+	if len(parts) != 2 {
+		return
+	}
+
+	st := &c.Sess.Booking
+	st.Date = parts[1]
+	st.Step = "pick_time_manual"
+	st.MsgID = 0
+
+	// клавиатура с временем больше не нужна — превращаем её в подсказку
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Введите время для "+st.Date+" (15:30 / 9:30 / 15.30)", nil)
+}
+
+// шаг pick_time_manual: время текстом
+func handleTimeManualInput(c *Ctx) {
+	timeStr, ok := normalizeTime(c.Text)
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Неверное время. Пример: 15:30 / 9:30 / 15.30 (только минуты 00 или 30)")
+		return
+	}
+	min, _ := parseClock(timeStr)
+	chooseTimeByText(c, min)
+}
+
+// chooseTimeByText — время введено текстом: проверяем, что оно свободно, и переходим к повторам
+// (или к подтверждению переноса)
+func chooseTimeByText(c *Ctx, min int) {
+	st := &c.Sess.Booking
+	slots, err := daySlots(c.DB, st.TeacherID, bookingChatID(c, st), st.Date, st.DurationMin, st.MoveID)
+	if err != nil {
+		slog.Error("get day slots error", "date", st.Date, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if problem := slotProblem(slots, min); problem != "" {
+		_ = c.TG.SendMessage(c.ChatID, problem)
+		return
+	}
+
+	// клавиатура с временем больше не нужна
+	if st.MsgID != 0 {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, st.MsgID, nil)
+	}
+
+	st.Time = clockLabel(min)
+	text, kb := afterTimeScreen(st)
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, text, kb)
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+// шаг pick_time: дата и время текстом ("25.06.2025 15:30") вместо кнопок
+func handleDateTimeInput(c *Ctx) {
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+
+	dt, err := time.ParseInLocation("02.01.2006 15:04", strings.TrimSpace(c.Text), loc)
+	if err != nil {
+		_ = c.TG.SendMessage(c.ChatID, "Неверный формат. Пример: 25.06.2025 15:30")
+		return
+	}
+	if dt.Before(time.Now().In(loc)) {
+		_ = c.TG.SendMessage(c.ChatID, "Нельзя записаться в прошлое")
+		return
+	}
+
+	c.Sess.Booking.Date = dt.Format("2006-01-02")
+	chooseTimeByText(c, dt.Hour()*60+dt.Minute())
+}
+
+// шаг pick_duration: длительность выбирается только кнопками — присылаем их ещё раз
+func handleDurationInput(c *Ctx) {
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, "Выберите длительность:", DurationKeyboard())
+}
+
+// dur_pick:60 или dur_pick:90
+func handleDurationPick(c *Ctx) {
+	mins, err := strconv.Atoi(strings.TrimPrefix(c.Data, "dur_pick:"))
+	if err != nil || (mins != 60 && mins != 90) {
+		return
+	}
+
+	st := &c.Sess.Booking
+	if st.Date == "" || st.TeacherID == 0 {
+		bookingExpired(c)
+		return
+	}
+	st.DurationMin = mins
+	st.MsgID = c.MsgID
+	editTimePicker(c, 0)
+}
+
+// шаг pick_repeat: 0/1/3/6 текстом
+func handleRepeatInput(c *Ctx) {
+	months, ok := parseRepeatMonths(strings.TrimSpace(c.Text))
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Введите 0, 1, 3 или 6")
+		return
+	}
+
+	st, start, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	if st.MsgID != 0 {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, st.MsgID, nil)
+	}
+	st.Repeat = presetRule(start, months)
+	st.Step = "confirm"
+	text, kb := confirmScreen(c, st, start)
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, text, kb)
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+// rep_pick:<месяцев> — пресет «каждую неделю на N месяцев» (0 — разово)
+func handleRepeatPick(c *Ctx) {
+	months, ok := parseRepeatMonths(strings.TrimPrefix(c.Data, "rep_pick:"))
+	if !ok {
+		return
+	}
+
+	st, start, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	st.Repeat = presetRule(start, months)
+	st.Step = "confirm"
+	st.MsgID = c.MsgID
+	text, kb := confirmScreen(c, st, start)
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, kb)
+}
+
+func parseRepeatMonths(s string) (int, bool) {
+	months, err := strconv.Atoi(s)
+	if err != nil || (months != 0 && months != 1 && months != 3 && months != 6) {
+		return 0, false
+	}
+	return months, true
+}
+
+// confirm_yes
+func handleConfirmYes(c *Ctx) {
+	// кнопки больше не нужны — убираем их, чтобы запись нельзя было подтвердить дважды
+	_ = c.TG.EditMessageReplyMarkup(c.ChatID, c.MsgID, nil)
+	confirmBooking(c, seriesAllOrNothing)
+}
+
+// rep_conflict:skip / rep_conflict:shift — подтвердить серию, решив, что делать с занятыми датами
+func handleConflictPick(c *Ctx) {
+	mode := strings.TrimPrefix(c.Data, "rep_conflict:")
+	if mode != seriesSkipBusy && mode != seriesShiftBusy {
+		return
+	}
+	_ = c.TG.EditMessageReplyMarkup(c.ChatID, c.MsgID, nil)
+	confirmBooking(c, mode)
+}
+
+// confirm_no
+func handleConfirmNo(c *Ctx) {
+	st := c.Sess.Booking
+	c.Sess.Booking = BookingState{}
+	if st.MoveID != 0 {
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, moveAborted(st), nil)
+		return
+	}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Запись отменена", nil)
+}
+
+// шаг confirm: «да» текстом вместо кнопки, всё остальное — отказ
+func handleConfirmInput(c *Ctx) {
+	st := &c.Sess.Booking
+	if st.MsgID != 0 {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, st.MsgID, nil)
+	}
+
+	if strings.ToLower(strings.TrimSpace(c.Text)) != "да" {
+		moving := *st
+		c.Sess.Booking = BookingState{}
+		if moving.MoveID != 0 {
+			_ = c.TG.SendMessage(c.ChatID, moveAborted(moving))
+			return
+		}
+		_ = c.TG.SendMessage(c.ChatID, "Запись отменена")
+		return
+	}
+	confirmBooking(c, seriesAllOrNothing)
+}
+
+// Что делать с занятыми датами серии при подтверждении
+const (
+	seriesAllOrNothing = "all"   // серия создаётся, только если свободны все даты
+	seriesSkipBusy     = "skip"  // занятые даты пропускаются
+	seriesShiftBusy    = "shift" // занятые даты переносятся на ближайшее свободное время того же дня
+)
+
+// confirmBooking создаёт запись (или серию по правилу повтора) по заполненной сессии.
+// Чем бы ни закончилось, сессия записи сбрасывается (кроме серии, которая не создалась
+// целиком в режиме seriesAllOrNothing — тогда ученику заново показываются даты).
+func confirmBooking(c *Ctx, mode string) {
+	st := c.Sess.Booking
+	c.Sess.Booking = BookingState{}
+
+	// не блокируем подтверждение по Step, проверяем по данным
+	if st.TeacherID == 0 || st.Date == "" || st.Time == "" || (st.DurationMin != 60 && st.DurationMin != 90) {
+		bookingExpired(c)
+		return
+	}
+
+	start, err := bookingStart(&st)
+	if err != nil {
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка даты/времени. Попробуйте заново.")
+		return
+	}
+	if start.Before(time.Now()) {
+		_ = c.TG.SendMessage(c.ChatID, "Нельзя записаться в прошлое")
+		return
+	}
+	if st.MoveID != 0 {
+		moveAppointment(c, st, start)
+		return
+	}
+
+	studentChatID, studentName, ok := bookingStudent(c, &st)
+	if !ok {
+		return
+	}
+
+	if st.Repeat == "" {
+		_, err := database.CreateAppointmentTx(c.DB, database.NewAppointment{
+			TeacherID:     st.TeacherID,
+			StudentChatID: studentChatID,
+			StudentName:   studentName,
+			StartTS:       start.Unix(),
+			DurationMin:   st.DurationMin,
+		})
+		switch {
+		case err == database.ErrSlotBusy && st.ForChatID != 0:
+			_ = c.TG.SendMessage(c.ChatID, "❌ Это время уже занято")
+			return
+		case err == database.ErrSlotBusy:
+			kb := WaitlistKeyboard(st.TeacherID, st.Date, start.Hour()*60+start.Minute(), st.DurationMin)
+			_ = c.TG.SendMessageInlineKeyboard(c.ChatID, "❌ Нельзя записаться на это время. Можно встать в лист ожидания:", kb)
+			return
+		case err == database.ErrOutsideWorkingHours:
+			_ = c.TG.SendMessage(c.ChatID, "❌ В это время преподаватель не работает")
+			return
+		case err == database.ErrBlockedPeriod:
+			_ = c.TG.SendMessage(c.ChatID, "❌ В это время преподаватель недоступен (отпуск или перерыв)")
+			return
+		case err != nil:
+			slog.Error("create appointment error", "err", err)
+			_ = c.TG.SendMessage(c.ChatID, "Ошибка записи в базу данных")
+			return
+		}
+
+		if st.ForChatID != 0 {
+			_ = c.TG.SendMessage(c.ChatID, "✅ Записали: "+studentName+", "+start.Format("02.01.2006 15:04")+", "+strconv.Itoa(st.DurationMin)+" мин")
+			notifyBookedStudent(c, studentChatID, st.TeacherID, "📌 Преподаватель записал вас на занятие\n"+
+				"Дата/время: "+start.Format("02.01.2006 15:04")+"\n"+
+				"Длительность: "+strconv.Itoa(st.DurationMin)+" мин")
+			return
+		}
+		_ = c.TG.SendMessage(c.ChatID, "✅ Вы записаны!")
+		notify := "📌 Новая запись\n" +
+			"Ученик: " + studentName + "\n" +
+			"Дата/время: " + start.Format("02.01.2006 15:04") + "\n" +
+			"Длительность: " + strconv.Itoa(st.DurationMin) + " мин"
+		notifyTeacher(c.TG, c.DB, st.TeacherID, notify)
+		return
+	}
+
+	rule := bookingRule(&st, start)
+	plan, err := planSeries(c.DB, st.TeacherID, studentChatID, rule.Occurrences(start), st.DurationMin)
+	if err != nil {
+		slog.Error("plan series error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if len(plan) == 0 {
+		_ = c.TG.SendMessage(c.ChatID, "По этим настройкам повтора не выходит ни одного занятия. Нажмите «Записаться» ещё раз.")
+		return
+	}
+
+	// занятые даты переносим на ближайшее свободное время того же дня
+	var starts []int64
+	var shiftedList []string
+	for _, l := range plan {
+		if mode == seriesShiftBusy && l.Problem != "" && !l.Shift.IsZero() {
+			starts = append(starts, l.Shift.Unix())
+			shiftedList = append(shiftedList, l.Start.Format("02.01.2006 15:04")+" → "+l.Shift.Format("15:04"))
+			continue
+		}
+		starts = append(starts, l.Start.Unix())
+	}
+
+	seriesID, conflicts, err := database.CreateSeriesTx(c.DB, database.Series{
+		TeacherID:     st.TeacherID,
+		StudentChatID: studentChatID,
+		StudentName:   studentName,
+		Rule:          rule.String(),
+		StartTS:       starts[0],
+		UntilTS:       starts[len(starts)-1],
+		DurationMin:   st.DurationMin,
+	}, starts, mode == seriesAllOrNothing)
+	if err != nil {
+		slog.Error("create series error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка записи в базу данных")
+		return
+	}
+
+	if seriesID == 0 && mode == seriesAllOrNothing {
+		// пока ученик смотрел на даты, часть из них заняли — показываем их заново
+		c.Sess.Booking = st
+		c.Sess.Booking.Step = "confirm"
+		text, kb := confirmScreen(c, &c.Sess.Booking, start)
+		mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, "❗ Часть дат уже занята, серия не создана.\n\n"+text, kb)
+		if err == nil {
+			c.Sess.Booking.MsgID = mid
+		}
+		return
+	}
+
+	var busyList, offHoursList []string
+	for _, cf := range conflicts {
+		when := time.Unix(cf.StartTS, 0).In(start.Location()).Format("02.01.2006 15:04")
+		if cf.Err == database.ErrOutsideWorkingHours || cf.Err == database.ErrBlockedPeriod {
+			offHoursList = append(offHoursList, when)
+		} else {
+			busyList = append(busyList, when)
+		}
+	}
+	createdCount := len(starts) - len(conflicts)
+
+	msg := "✅ Создано записей: " + strconv.Itoa(createdCount)
+	if len(shiftedList) > 0 {
+		msg += "\n\n↔️ Перенесено на другое время:\n- " + strings.Join(shiftedList, "\n- ")
+	}
+	if len(busyList) > 0 {
+		msg += "\n\n❌ Не удалось (занято):\n- " + strings.Join(busyList, "\n- ")
+	}
+	if len(offHoursList) > 0 {
+		msg += "\n\n❌ Не удалось (преподаватель не работает):\n- " + strings.Join(offHoursList, "\n- ")
+	}
+	_ = c.TG.SendMessage(c.ChatID, msg)
+	if createdCount == 0 {
+		return
+	}
+	if st.ForChatID != 0 {
+		notifyBookedStudent(c, studentChatID, st.TeacherID, "📌 Преподаватель записал вас на серию занятий\n"+
+			"Старт: "+time.Unix(starts[0], 0).In(start.Location()).Format("02.01.2006 15:04")+"\n"+
+			"Повтор: "+repeatLabel(rule, start)+"\n"+
+			"Длительность: "+strconv.Itoa(st.DurationMin)+" мин\n"+
+			"Создано: "+strconv.Itoa(createdCount))
+		return
+	}
+	notify := "📌 Новая серия записей\n" +
+		"Ученик: " + studentName + "\n" +
+		"Старт: " + time.Unix(starts[0], 0).In(start.Location()).Format("02.01.2006 15:04") + "\n" +
+		"Повтор: " + repeatLabel(rule, start) + "\n" +
+		"Длительность: " + strconv.Itoa(st.DurationMin) + " мин\n" +
+		"Создано: " + strconv.Itoa(createdCount)
+	notifyTeacher(c.TG, c.DB, st.TeacherID, notify)
+}
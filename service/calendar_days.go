@@ -0,0 +1,142 @@
+package service
+
+import (
+	calendar "bot/calendarwidget"
+	"bot/database"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarDurationMin — по самому короткому занятию решаем, остался ли в дне свободный слот
+const calendarDurationMin = 60
+
+// Назначение календаря — зашито в кнопки (см. calendar.ParseCallback)
+const (
+	calBooking     = "book_" // запись ученика, дальше — id преподавателя: "book_3"
+	calTeacherDays = "tday"  // «Записи по дням» преподавателя
+)
+
+// bookingPurpose — календарь записи к преподавателю teacherID
+func bookingPurpose(teacherID int64) string {
+	return calBooking + strconv.FormatInt(teacherID, 10)
+}
+
+// bookingTeacherID — к какому преподавателю календарь записи (false — это не календарь записи)
+func bookingTeacherID(purpose string) (int64, bool) {
+	idStr, ok := strings.CutPrefix(purpose, calBooking)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// bookingCalendar — календарь преподавателя teacherID на месяц year/month.
+// Ученику недоступные дни зачёркнуты, преподавателю — число занятий в каждом дне;
+// закрытые целиком дни (отпуск) помечены ⛔ у обоих.
+func bookingCalendar(c *Ctx, purpose string, teacherID int64, year int, month time.Month) *calendar.Calendar {
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	now := time.Now().In(loc)
+
+	opt := calendar.Options{
+		Language:     "ru",
+		InitialYear:  year,
+		InitialMonth: month,
+		Purpose:      purpose,
+	}
+
+	monthStart := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	apps, err := database.GetAppointmentsByDay(c.DB, teacherID, monthStart.Unix(), monthStart.AddDate(0, 1, 0).Unix())
+	if err != nil {
+		// без отметок календарь всё равно рабочий: занятость проверится при выборе времени
+		slog.Error("get month appointments error", "err", err)
+		return calendar.NewCalendar(opt)
+	}
+	byDay := make(map[int][]database.Appointment)
+	for _, a := range apps {
+		d := time.Unix(a.StartTS, 0).In(loc).Day()
+		byDay[d] = append(byDay[d], a)
+	}
+	blocked, err := database.GetBlockedPeriods(c.DB, teacherID, monthStart.Format("2006-01-02"))
+	if err != nil {
+		// без отметок календарь всё равно рабочий: недоступность проверится при записи
+		slog.Error("get blocked periods error", "err", err)
+	}
+
+	if purpose == calTeacherDays {
+		opt.DayInfo = func(day time.Time) calendar.DayInfo {
+			// свой отпуск преподаватель видит, но день остаётся кликабельным — посмотреть записи
+			var marker string
+			if blocked.WholeDay(time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)) {
+				marker = calendar.BlockedMarker
+			}
+			n := len(byDay[day.Day()])
+			if n == 0 {
+				return calendar.DayInfo{Marker: marker}
+			}
+			return calendar.DayInfo{State: calendar.DayHasAppointments, Marker: "•" + strconv.Itoa(n) + marker}
+		}
+		return calendar.NewCalendar(opt)
+	}
+
+	// ученик: в прошлое записаться нельзя
+	opt.MinDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	// время, которое держится за другими из листа ожидания, для него тоже занято
+	held, err := heldOffers(c.DB, teacherID, bookingChatID(c, &c.Sess.Booking), monthStart.Unix(), monthStart.AddDate(0, 1, 0).Unix())
+	if err != nil {
+		slog.Error("get waitlist offers error", "err", err)
+	}
+	for _, a := range held {
+		d := time.Unix(a.StartTS, 0).In(loc).Day()
+		byDay[d] = append(byDay[d], a)
+	}
+
+	week, err := database.GetWeeklyHours(c.DB, teacherID)
+	if err != nil {
+		slog.Error("get working hours error", "err", err)
+		return calendar.NewCalendar(opt)
+	}
+	exceptions, err := database.GetWorkingHoursExceptions(c.DB, teacherID, monthStart.Format("2006-01-02"))
+	if err != nil {
+		slog.Error("get working hours exceptions error", "err", err)
+		return calendar.NewCalendar(opt)
+	}
+	special := make(map[string]database.WorkingHours, len(exceptions))
+	for _, e := range exceptions {
+		special[e.Date] = e.WorkingHours
+	}
+
+	nowTS := now.Unix()
+	opt.DayInfo = func(d time.Time) calendar.DayInfo {
+		day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
+		if blocked.WholeDay(day) {
+			return calendar.DayInfo{State: calendar.DayBlocked}
+		}
+		wh, isException := special[day.Format("2006-01-02")]
+		if !isException {
+			wh = week[day.Weekday()]
+		}
+		if wh.DayOff {
+			// особый выходной на дату (праздник, отпуск) отмечаем отдельно от обычных
+			if isException {
+				return calendar.DayInfo{State: calendar.DayHoliday}
+			}
+			return calendar.DayInfo{State: calendar.DayDisabled}
+		}
+
+		slots := computeSlots(day, wh, blocked, byDay[day.Day()], calendarDurationMin, nowTS)
+		if len(slots) == 0 {
+			return calendar.DayInfo{State: calendar.DayDisabled}
+		}
+		for _, s := range slots {
+			if !s.Busy {
+				return calendar.DayInfo{}
+			}
+		}
+		return calendar.DayInfo{State: calendar.DayFullyBooked}
+	}
+	return calendar.NewCalendar(opt)
+}
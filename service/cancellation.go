@@ -0,0 +1,497 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Правила отмены. Ученик отменяет бесплатно не позже чем за cancelNotice до начала;
+// позже отмена считается поздней: запись удаляется, но остаётся в истории отмен
+// (cancellations) с отметкой late, а преподаватель может её простить.
+// Отмены преподавателем поздними не бывают.
+// Об отмене всегда узнаёт другая сторона — с причиной, если её указали, а ученик
+// получает кнопку «записаться снова» (rebook:<cancellation_id>).
+// Кнопки: cancel_app:<id> (экран подтверждения), cancel_yes:<id>, cancel_why:<id>, cancel_keep,
+// t_cancel_app:<id>:<YYYY-MM-DD>, t_cancel_yes:…, t_cancel_why:…, t_cancel_no,
+// t_waive:<cancellation_id>[:list]
+
+// Срок бесплатной отмены и оплата поздней (меняются через Config)
+var (
+	cancelNotice            = 24 * time.Hour
+	lateCancelChargePercent = 0
+)
+
+// поздние отмены в меню преподавателя — за сколько дней
+const lateCancelListDays = 30
+
+// studentCancelTerms — ученик отменяет сейчас: всё, что начнётся раньше чем через cancelNotice, — поздно
+func studentCancelTerms() database.CancelTerms {
+	return database.CancelTerms{
+		By:            database.CanceledByStudent,
+		LateBeforeTS:  time.Now().Add(cancelNotice).Unix(),
+		ChargePercent: lateCancelChargePercent,
+	}
+}
+
+func teacherCancelTerms() database.CancelTerms {
+	return database.CancelTerms{By: database.CanceledByTeacher}
+}
+
+// noticeLabel: "24 часа"
+func noticeLabel() string {
+	h := int(cancelNotice.Hours())
+	return strconv.Itoa(h) + " " + plural(h, "час", "часа", "часов")
+}
+
+// cancelPolicyText — правила отмены для ученика
+func cancelPolicyText() string {
+	text := "📋 Отмена бесплатная не позже чем за " + noticeLabel() + " до начала занятия. Позже отмена считается поздней"
+	if lateCancelChargePercent > 0 {
+		return text + " — занятие оплачивается на " + strconv.Itoa(lateCancelChargePercent) + "%."
+	}
+	return text + " и отмечается у преподавателя."
+}
+
+// lateChargeLabel: "к оплате 100%" / "прощено" / ""
+func lateChargeLabel(c database.Cancellation) string {
+	switch {
+	case c.Waived:
+		return "прощено"
+	case c.ChargePercent > 0:
+		return "к оплате " + strconv.Itoa(c.ChargePercent) + "%"
+	}
+	return ""
+}
+
+// «Отменить запись» — записи ученика с кнопками отмены, сверху — правила
+func handleCancelMenu(c *Ctx) {
+	sendFutureAppointments(c, cancelPolicyText()+"\n\nВыберите запись для отмены:", func(a database.Appointment, when string) telegram.InlineKeyboardButton {
+		return telegram.InlineKeyboardButton{Text: "❌ " + when, CallbackData: "cancel_app:" + strconv.FormatInt(a.ID, 10)}
+	})
+}
+
+// cancel_app:<id> — ученик выбрал запись: показываем, будет ли отмена поздней, и спрашиваем
+func handleStudentCancel(c *Ctx) {
+	a, ok := studentCancelTarget(c, strings.TrimPrefix(c.Data, "cancel_app:"))
+	if !ok {
+		return
+	}
+
+	text := "Отменить занятие " + moveWhen(a.StartTS) + "?\n\n" + cancelPolicyText() + "\n\n"
+	if a.StartTS < studentCancelTerms().LateBeforeTS {
+		text += "⚠️ До занятия меньше " + noticeLabel() + " — отмена будет поздней."
+	} else {
+		text += "✅ Отмена бесплатная."
+	}
+	id := strconv.FormatInt(a.ID, 10)
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{
+		{
+			{Text: "✅ Да, отменить", CallbackData: "cancel_yes:" + id},
+			{Text: "✏️ Указать причину", CallbackData: "cancel_why:" + id},
+		},
+		{{Text: "Нет, оставить", CallbackData: "cancel_keep"}},
+	}}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, kb)
+}
+
+// cancel_why:<id> — причину ученик пишет следующим сообщением (шаг cancel_reason)
+func handleStudentCancelWhy(c *Ctx) {
+	a, ok := studentCancelTarget(c, strings.TrimPrefix(c.Data, "cancel_why:"))
+	if !ok {
+		return
+	}
+	c.Sess.StudentStatus = "cancel_reason"
+	c.Sess.CancelAppID = a.ID
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+		{Text: "Без причины", CallbackData: "cancel_yes:" + strconv.FormatInt(a.ID, 10)},
+		{Text: "Нет, оставить", CallbackData: "cancel_keep"},
+	}}}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Отмена занятия "+moveWhen(a.StartTS)+".\nНапишите причину одним сообщением — её увидит преподаватель:", kb)
+}
+
+// шаг cancel_reason: текст — причина, запись отменяется
+func handleStudentCancelReason(c *Ctx) {
+	id := c.Sess.CancelAppID
+	c.Sess.StudentStatus = ""
+	c.Sess.CancelAppID = 0
+
+	a, ok := studentCancelTarget(c, strconv.FormatInt(id, 10))
+	if !ok {
+		return
+	}
+	text, kb := studentCancel(c, a, strings.TrimSpace(c.Text))
+	if kb == nil {
+		_ = c.TG.SendMessage(c.ChatID, text)
+		return
+	}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, text, kb)
+}
+
+// cancel_yes:<id>
+func handleStudentCancelConfirm(c *Ctx) {
+	c.Sess.StudentStatus = ""
+	c.Sess.CancelAppID = 0
+
+	a, ok := studentCancelTarget(c, strings.TrimPrefix(c.Data, "cancel_yes:"))
+	if !ok {
+		return
+	}
+	text, kb := studentCancel(c, a, "")
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, kb)
+}
+
+// cancel_keep — «Нет, оставить»
+func handleStudentCancelKeep(c *Ctx) {
+	c.Sess.StudentStatus = ""
+	c.Sess.CancelAppID = 0
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Запись сохранена", nil)
+}
+
+// studentCancel отменяет запись ученика, сообщает преподавателю и возвращает ответ ученику
+// (с кнопкой «записаться снова»)
+func studentCancel(c *Ctx, a database.Appointment, reason string) (string, *telegram.InlineKeyboardMarkup) {
+	terms := studentCancelTerms()
+	terms.Reason = reason
+	canceled, err := database.CancelAppointmentTx(c.DB, a, terms)
+	switch {
+	case err == database.ErrAppointmentChanged:
+		return "Запись уже изменилась или отменена", nil
+	case err != nil:
+		slog.Error("cancel appointment error", "appointment_id", a.ID, "err", err)
+		return "Ошибка отмены записи", nil
+	}
+
+	text := "✅ Запись отменена"
+	if canceled.Late {
+		text += "\n⚠️ Отмена поздняя"
+		if canceled.ChargePercent > 0 {
+			text += ": занятие оплачивается на " + strconv.Itoa(canceled.ChargePercent) + "%"
+		}
+	}
+	notifyCancelTeacher(c.TG, c.DB, canceled)
+	offerFreedSlot(c.TG, c.DB, a.TeacherID, a.StartTS)
+	return text, rebookKeyboard(canceled)
+}
+
+// studentCancelTarget — будущая запись ученика по id (из кнопки или сессии)
+func studentCancelTarget(c *Ctx, idStr string) (database.Appointment, bool) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return database.Appointment{}, false
+	}
+	a, ok, err := database.GetAppointment(c.DB, id)
+	if err != nil {
+		slog.Error("get appointment error", "appointment_id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return database.Appointment{}, false
+	}
+	if !ok || a.StudentChatID != c.ChatID || a.StartTS <= time.Now().Unix() {
+		const gone = "Запись не найдена: её уже отменили или она прошла"
+		if c.Data != "" {
+			_ = c.TG.EditMessageText(c.ChatID, c.MsgID, gone, nil)
+		} else {
+			_ = c.TG.SendMessage(c.ChatID, gone)
+		}
+		return database.Appointment{}, false
+	}
+	return a, true
+}
+
+// cancelDetails: "Занятие: 17.11.2026 17:30, 60 мин" и причина, если указана
+func cancelDetails(lc database.Cancellation) string {
+	text := "Занятие: " + moveWhen(lc.StartTS) + ", " + strconv.Itoa(lc.DurationMin) + " мин"
+	if lc.Reason != "" {
+		text += "\nПричина: " + lc.Reason
+	}
+	return text
+}
+
+// notifyCancelTeacher сообщает преподавателю об отмене учеником;
+// у поздней отмены — кнопка «простить»
+func notifyCancelTeacher(tg *telegram.Client, db *sql.DB, lc database.Cancellation) {
+	text := "❌ Ученик отменил занятие\n" +
+		"Ученик: " + lc.StudentName + "\n" +
+		cancelDetails(lc)
+	if !lc.Late {
+		notifyTeacher(tg, db, lc.TeacherID, text)
+		return
+	}
+
+	text += "\n⚠️ Поздняя отмена"
+	if label := lateChargeLabel(lc); label != "" {
+		text += ", " + label
+	}
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+		{Text: "🙏 Простить", CallbackData: "t_waive:" + strconv.FormatInt(lc.ID, 10)},
+	}}}
+	notifyTeacherKeyboard(tg, db, lc.TeacherID, text, kb)
+}
+
+// notifyCancelStudent сообщает ученику, что преподаватель отменил занятие, и предлагает записаться снова
+func notifyCancelStudent(tg *telegram.Client, db *sql.DB, lc database.Cancellation) {
+	text := "❌ Преподаватель отменил занятие\n" + cancelDetails(lc)
+	if t, ok, err := database.GetTeacher(db, lc.TeacherID); err == nil && ok {
+		text += "\nПреподаватель: " + t.DisplayName()
+	}
+	notifyStudentKeyboard(tg, db, lc.StudentChatID, text, rebookKeyboard(lc))
+}
+
+// rebookKeyboard — «записаться снова» к тому же преподавателю
+func rebookKeyboard(lc database.Cancellation) *telegram.InlineKeyboardMarkup {
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+		{Text: "📅 Записаться на другое время", CallbackData: "rebook:" + strconv.FormatInt(lc.ID, 10)},
+	}}}
+}
+
+// rebook:<cancellation_id> — запись к тому же преподавателю: сразу календарь
+func handleRebook(c *Ctx) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(c.Data, "rebook:"), 10, 64)
+	if err != nil {
+		return
+	}
+	lc, ok, err := database.GetCancellation(c.DB, id)
+	if err != nil {
+		slog.Error("get cancellation error", "cancellation_id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok || lc.StudentChatID != c.ChatID {
+		return
+	}
+	t, ok, err := database.GetTeacher(c.DB, lc.TeacherID)
+	if err != nil {
+		slog.Error("get teacher error", "teacher_id", lc.TeacherID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Этого преподавателя больше нет. Нажмите «Записаться».")
+		return
+	}
+
+	st := &c.Sess.Booking
+	if st.MsgID != 0 {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, st.MsgID, nil)
+	}
+	*st = BookingState{Step: "pick_date", TeacherID: t.ID}
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, "Преподаватель: "+t.DisplayName()+
+		"\nВместо занятия "+moveWhen(lc.StartTS)+"\nВыберите дату:", tutorCalendar(c, t.ID))
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+// t_cancel_app:<id>:<YYYY-MM-DD> — преподаватель выбрал запись: спрашиваем, с причиной или без
+func handleTeacherCancel(c *Ctx) {
+	a, date, ok := teacherCancelTarget(c, "t_cancel_app:")
+	if !ok {
+		return
+	}
+	suffix := strconv.FormatInt(a.ID, 10) + ":" + date
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{
+		{
+			{Text: "✅ Да, отменить", CallbackData: "t_cancel_yes:" + suffix},
+			{Text: "✏️ Указать причину", CallbackData: "t_cancel_why:" + suffix},
+		},
+		{{Text: "Нет, оставить", CallbackData: "t_cancel_no"}},
+	}}
+	text := "Отменить занятие " + moveWhen(a.StartTS) + " — " + a.StudentName + "?"
+	if !isPlaceholder(c.DB, a.StudentChatID) {
+		text += "\nУченик получит уведомление."
+	}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, text, kb)
+}
+
+// t_cancel_why:<id>:<YYYY-MM-DD> — причину преподаватель пишет следующим сообщением (шаг t_cancel_reason)
+func handleTeacherCancelWhy(c *Ctx) {
+	a, date, ok := teacherCancelTarget(c, "t_cancel_why:")
+	if !ok {
+		return
+	}
+	c.Sess.TeacherStatus = "t_cancel_reason"
+	c.Sess.CancelAppID = a.ID
+	c.Sess.CancelDate = date
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+		{Text: "Без причины", CallbackData: "t_cancel_yes:" + strconv.FormatInt(a.ID, 10) + ":" + date},
+		{Text: "Нет, оставить", CallbackData: "t_cancel_no"},
+	}}}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Отмена занятия "+moveWhen(a.StartTS)+" — "+a.StudentName+
+		"\nНапишите причину одним сообщением — её увидит ученик:", kb)
+}
+
+// шаг t_cancel_reason
+func handleTeacherCancelReason(c *Ctx) {
+	id, date := c.Sess.CancelAppID, c.Sess.CancelDate
+	c.Sess.TeacherStatus = ""
+	c.Sess.CancelAppID = 0
+	c.Sess.CancelDate = ""
+
+	a, ok, err := database.GetAppointment(c.DB, id)
+	if err != nil {
+		slog.Error("get appointment error", "appointment_id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok || a.TeacherID != currentTeacherID(c.ChatID) {
+		_ = c.TG.SendMessage(c.ChatID, "Запись не найдена: её уже отменили")
+		return
+	}
+	_ = c.TG.SendMessage(c.ChatID, teacherCancel(c, a, strings.TrimSpace(c.Text)))
+	sendTeacherDay(c, date, "больше нет записей.")
+}
+
+// t_cancel_yes:<id>:<YYYY-MM-DD>
+func handleTeacherCancelConfirm(c *Ctx) {
+	c.Sess.TeacherStatus = ""
+	c.Sess.CancelAppID = 0
+	c.Sess.CancelDate = ""
+
+	a, date, ok := teacherCancelTarget(c, "t_cancel_yes:")
+	if !ok {
+		return
+	}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, teacherCancel(c, a, ""), nil)
+
+	// сразу показываем список заново на эту дату
+	sendTeacherDay(c, date, "больше нет записей.")
+}
+
+// t_cancel_no
+func handleTeacherCancelKeep(c *Ctx) {
+	c.Sess.TeacherStatus = ""
+	c.Sess.CancelAppID = 0
+	c.Sess.CancelDate = ""
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Запись сохранена", nil)
+}
+
+// teacherCancel отменяет запись преподавателем и сообщает ученику; возвращает ответ преподавателю
+func teacherCancel(c *Ctx, a database.Appointment, reason string) string {
+	terms := teacherCancelTerms()
+	terms.Reason = reason
+	canceled, err := database.CancelAppointmentTx(c.DB, a, terms)
+	switch {
+	case err == database.ErrAppointmentChanged:
+		return "Запись уже изменилась или отменена"
+	case err != nil:
+		slog.Error("cancel appointment error", "appointment_id", a.ID, "err", err)
+		return "Ошибка отмены записи"
+	}
+	notifyCancelStudent(c.TG, c.DB, canceled)
+	offerFreedSlot(c.TG, c.DB, a.TeacherID, a.StartTS)
+	if isPlaceholder(c.DB, a.StudentChatID) {
+		return "✅ Запись отменена"
+	}
+	return "✅ Запись отменена, ученик получил уведомление"
+}
+
+// teacherCancelTarget — запись вошедшего преподавателя из кнопки <prefix><id>:<YYYY-MM-DD>
+func teacherCancelTarget(c *Ctx, prefix string) (database.Appointment, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(c.Data, prefix), ":")
+	if len(parts) != 2 {
+		return database.Appointment{}, "", false
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return database.Appointment{}, "", false
+	}
+	a, ok, err := database.GetAppointment(c.DB, id)
+	if err != nil {
+		slog.Error("get appointment error", "appointment_id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return database.Appointment{}, "", false
+	}
+	if !ok || a.TeacherID != currentTeacherID(c.ChatID) {
+		_ = c.TG.SendMessage(c.ChatID, "Запись не найдена: её уже отменили")
+		sendTeacherDay(c, parts[1], "больше нет записей.")
+		return database.Appointment{}, "", false
+	}
+	return a, parts[1], true
+}
+
+// «Поздние отмены» — за последние lateCancelListDays дней, с кнопками «простить»
+func handleLateCancellations(c *Ctx) {
+	sendLateCancellations(c, 0)
+}
+
+// sendLateCancellations присылает список (или, если msgID != 0, показывает его в этом сообщении)
+func sendLateCancellations(c *Ctx, msgID int) {
+	from := time.Now().AddDate(0, 0, -lateCancelListDays).Unix()
+	list, err := database.GetLateCancellations(c.DB, currentTeacherID(c.ChatID), from)
+	if err != nil {
+		slog.Error("get late cancellations error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+
+	text := "Поздних отмен за " + strconv.Itoa(lateCancelListDays) + " дней нет."
+	var rows [][]telegram.InlineKeyboardButton
+	if len(list) > 0 {
+		var b strings.Builder
+		b.WriteString("⚠️ Поздние отмены за " + strconv.Itoa(lateCancelListDays) + " дней:\n")
+		for _, lc := range list {
+			b.WriteString("\n" + moveWhen(lc.StartTS) + " — " + lc.StudentName + ", " + strconv.Itoa(lc.DurationMin) + " мин")
+			if label := lateChargeLabel(lc); label != "" {
+				b.WriteString(" (" + label + ")")
+			}
+			if !lc.Waived {
+				rows = append(rows, []telegram.InlineKeyboardButton{{
+					Text:         "🙏 Простить: " + moveWhen(lc.StartTS) + " " + lc.StudentName,
+					CallbackData: "t_waive:" + strconv.FormatInt(lc.ID, 10) + ":list",
+				}})
+			}
+		}
+		text = b.String()
+	}
+
+	var kb *telegram.InlineKeyboardMarkup
+	if len(rows) > 0 {
+		kb = &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+	}
+	if msgID != 0 {
+		_ = c.TG.EditMessageText(c.ChatID, msgID, text, kb)
+		return
+	}
+	if kb == nil {
+		_ = c.TG.SendMessage(c.ChatID, text)
+		return
+	}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, text, kb)
+}
+
+// t_waive:<cancellation_id>[:list] — преподаватель прощает позднюю отмену
+func handleWaiveCancel(c *Ctx) {
+	parts := strings.Split(strings.TrimPrefix(c.Data, "t_waive:"), ":")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	fromList := len(parts) == 2 && parts[1] == "list"
+
+	waived, err := database.WaiveCancellation(c.DB, id, currentTeacherID(c.ChatID))
+	if err != nil {
+		slog.Error("waive cancellation error", "cancellation_id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка записи в базу данных")
+		return
+	}
+	if fromList {
+		sendLateCancellations(c, c.MsgID)
+	} else {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, c.MsgID, nil)
+	}
+	if !waived {
+		_ = c.TG.SendMessage(c.ChatID, "Эта отмена уже прощена")
+		return
+	}
+
+	lc, ok, err := database.GetCancellation(c.DB, id)
+	if err != nil || !ok {
+		return
+	}
+	_ = c.TG.SendMessage(c.ChatID, "✅ Поздняя отмена прощена: "+moveWhen(lc.StartTS)+", "+lc.StudentName)
+	notifyStudent(c.TG, c.DB, lc.StudentChatID, "🙏 Преподаватель простил позднюю отмену занятия "+moveWhen(lc.StartTS))
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config — настройки запуска бота
+type Config struct {
+	// Если Webhook.URL пустой — бот работает через long polling (getUpdates)
+	Webhook WebhookConfig
+
+	// Сколько живёт вход преподавателя без активности. 0 — по умолчанию (30 дней)
+	TeacherSessionTTL time.Duration
+
+	// Через сколько брошенный диалог (недозаполненная запись и т.п.) забывается.
+	// 0 — по умолчанию (24 часа)
+	SessionTTL time.Duration
+
+	// Сколько обновлений обрабатывается параллельно. 0 — по умолчанию (8)
+	Workers int
+
+	// Сколько держится предложение освободившегося времени из листа ожидания.
+	// 0 — по умолчанию (30 минут)
+	WaitlistOfferTTL time.Duration
+
+	// За сколько до начала ученик может отменить занятие бесплатно.
+	// 0 — по умолчанию (24 часа)
+	CancelNotice time.Duration
+
+	// Сколько процентов занятия оплачивается при поздней отмене. 0 — не оплачивается
+	LateCancelChargePercent int
+
+	// Логин основного преподавателя: он первый в списке у учеников.
+	// Пусто — отметка в базе не меняется
+	PrimaryTeacher string
+}
+
+type WebhookConfig struct {
+	// Публичный HTTPS-адрес, который регистрируем в setWebhook
+	URL string
+
+	// Адрес, на котором слушает HTTP-сервер, например ":8080"
+	ListenAddr string
+
+	// Путь обработчика. По умолчанию берётся из URL
+	// (за reverse proxy путь может отличаться)
+	Path string
+
+	// Секрет для заголовка X-Telegram-Bot-Api-Secret-Token
+	SecretToken string
+
+	// Публичный сертификат для загрузки в setWebhook (только самоподписанный)
+	CertFile string
+
+	// Сертификат и ключ, если сервер сам терминирует TLS (без reverse proxy)
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// Enabled — включён ли режим webhook
+func (c WebhookConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// handlerPath — путь, на котором принимаем обновления
+func (c WebhookConfig) handlerPath() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	if u, err := url.Parse(c.URL); err == nil && u.Path != "" {
+		return u.Path
+	}
+	return "/"
+}
+
+// ConfigFromEnv читает настройки из переменных окружения:
+// WEBHOOK_URL, WEBHOOK_LISTEN, WEBHOOK_PATH, WEBHOOK_SECRET,
+// WEBHOOK_CERT, WEBHOOK_TLS_CERT, WEBHOOK_TLS_KEY, TEACHER_SESSION_TTL_HOURS,
+// SESSION_TTL_HOURS, WORKERS, WAITLIST_OFFER_MINUTES, CANCEL_NOTICE_HOURS,
+// LATE_CANCEL_CHARGE_PERCENT, PRIMARY_TEACHER
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Webhook: WebhookConfig{
+			URL:         os.Getenv("WEBHOOK_URL"),
+			ListenAddr:  os.Getenv("WEBHOOK_LISTEN"),
+			Path:        os.Getenv("WEBHOOK_PATH"),
+			SecretToken: os.Getenv("WEBHOOK_SECRET"),
+			CertFile:    os.Getenv("WEBHOOK_CERT"),
+			TLSCertFile: os.Getenv("WEBHOOK_TLS_CERT"),
+			TLSKeyFile:  os.Getenv("WEBHOOK_TLS_KEY"),
+		},
+		PrimaryTeacher: os.Getenv("PRIMARY_TEACHER"),
+	}
+	if cfg.Webhook.ListenAddr == "" {
+		cfg.Webhook.ListenAddr = ":8080"
+	}
+	if h, err := strconv.Atoi(os.Getenv("TEACHER_SESSION_TTL_HOURS")); err == nil && h > 0 {
+		cfg.TeacherSessionTTL = time.Duration(h) * time.Hour
+	}
+	if h, err := strconv.Atoi(os.Getenv("SESSION_TTL_HOURS")); err == nil && h > 0 {
+		cfg.SessionTTL = time.Duration(h) * time.Hour
+	}
+	if n, err := strconv.Atoi(os.Getenv("WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if m, err := strconv.Atoi(os.Getenv("WAITLIST_OFFER_MINUTES")); err == nil && m > 0 {
+		cfg.WaitlistOfferTTL = time.Duration(m) * time.Minute
+	}
+	if h, err := strconv.Atoi(os.Getenv("CANCEL_NOTICE_HOURS")); err == nil && h > 0 {
+		cfg.CancelNotice = time.Duration(h) * time.Hour
+	}
+	if p, err := strconv.Atoi(os.Getenv("LATE_CANCEL_CHARGE_PERCENT")); err == nil && p > 0 && p <= 100 {
+		cfg.LateCancelChargePercent = p
+	}
+	return cfg
+}
@@ -1,13 +1,20 @@
 package service
 
-import "bot/telegram"
+import (
+	"bot/database"
+	"bot/telegram"
+	"strconv"
+)
 
 func Studkeyboard() *telegram.ReplyKeyboardMarkup {
 	return &telegram.ReplyKeyboardMarkup{
 		Keyboard: [][]telegram.KeyboardButton{
 			{{Text: "Записаться"}},
 			{{Text: "Мои записи"}},
+			{{Text: "Мои серии"}},
+			{{Text: "Перенести запись"}},
 			{{Text: "Отменить запись"}},
+			{{Text: "Настройки"}},
 			{{Text: "Назад"}},
 		},
 		ResizeKeyboard:  true,
@@ -26,6 +33,20 @@ func Rolekeyboard() *telegram.ReplyKeyboardMarkup {
 	}
 }
 
+// TutorKeyboard: tutor:<teacher_id>, по преподавателю в строке
+func TutorKeyboard(teachers []database.Teacher) *telegram.InlineKeyboardMarkup {
+	var rows [][]telegram.InlineKeyboardButton
+	for _, t := range teachers {
+		rows = append(rows, []telegram.InlineKeyboardButton{
+			{Text: t.DisplayName(), CallbackData: "tutor:" + strconv.FormatInt(t.ID, 10)},
+		})
+	}
+	rows = append(rows, []telegram.InlineKeyboardButton{
+		{Text: "Отмена", CallbackData: "booking_cancel"},
+	})
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
 func DurationKeyboard() *telegram.InlineKeyboardMarkup {
 	return &telegram.InlineKeyboardMarkup{
 		InlineKeyboard: [][]telegram.InlineKeyboardButton{
@@ -55,6 +76,12 @@ func Teachkeyboard() *telegram.ReplyKeyboardMarkup {
 	return &telegram.ReplyKeyboardMarkup{
 		Keyboard: [][]telegram.KeyboardButton{
 			{{Text: "Записи по дням"}},
+			{{Text: "Записать ученика"}},
+			{{Text: "Серии"}},
+			{{Text: "Поздние отмены"}},
+			{{Text: "Рабочее время"}},
+			{{Text: "Отпуск и перерывы"}},
+			{{Text: "Выйти"}},
 			{{Text: "Назад"}},
 		},
 		ResizeKeyboard:  true,
@@ -77,9 +104,57 @@ func RepeatKeyboard() *telegram.InlineKeyboardMarkup {
 			{
 				{Text: "каждую неделю на 6 месяцев", CallbackData: "rep_pick:6"},
 			},
+			{
+				{Text: "⚙️ Настроить повтор", CallbackData: "rep_custom"},
+			},
 			{
 				{Text: "Отмена", CallbackData: "booking_cancel"},
 			},
 		},
 	}
 }
+
+// Сколько учеников на одной странице выбора
+const studentsPerPage = 8
+
+// StudentPickKeyboard — выбор ученика для записи преподавателем (страница page),
+// ниже — завести нового ученика без Telegram
+func StudentPickKeyboard(students []database.Student, page int) *telegram.InlineKeyboardMarkup {
+	pages := (len(students) + studentsPerPage - 1) / studentsPerPage
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	var rows [][]telegram.InlineKeyboardButton
+	for i := page * studentsPerPage; i < len(students) && i < (page+1)*studentsPerPage; i++ {
+		s := students[i]
+		label := s.Name
+		if s.Placeholder {
+			label += " 📵"
+		}
+		rows = append(rows, []telegram.InlineKeyboardButton{
+			{Text: label, CallbackData: "t_book_st:" + strconv.FormatInt(s.ChatID, 10)},
+		})
+	}
+
+	if pages > 1 {
+		var nav []telegram.InlineKeyboardButton
+		if page > 0 {
+			nav = append(nav, telegram.InlineKeyboardButton{Text: "◀️", CallbackData: "t_book_page:" + strconv.Itoa(page-1)})
+		}
+		nav = append(nav, telegram.InlineKeyboardButton{Text: strconv.Itoa(page+1) + "/" + strconv.Itoa(pages), CallbackData: "noop"})
+		if page < pages-1 {
+			nav = append(nav, telegram.InlineKeyboardButton{Text: "▶️", CallbackData: "t_book_page:" + strconv.Itoa(page+1)})
+		}
+		rows = append(rows, nav)
+	}
+
+	rows = append(rows,
+		[]telegram.InlineKeyboardButton{{Text: "➕ Новый ученик (без Telegram)", CallbackData: "t_book_new"}},
+		[]telegram.InlineKeyboardButton{{Text: "Отмена", CallbackData: "booking_cancel"}},
+	)
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// как часто проверяем очередь напоминаний
+const reminderPollInterval = 30 * time.Second
+
+// сколько напоминаний забираем за один проход
+const reminderBatchSize = 100
+
+// сколько раз пробуем отправить напоминание, которое точно не ушло; пауза перед повтором
+// удваивается, начиная с reminderRetryDelay (1, 2, 4, 8 минут)
+const (
+	reminderMaxAttempts = 5
+	reminderRetryDelay  = time.Minute
+)
+
+// runReminders в фоне отправляет напоминания, время которых наступило.
+// Очередь хранится в таблице reminders, поэтому переживает перезапуски бота.
+func runReminders(tg *telegram.Client, db *sql.DB) {
+	ticker := time.NewTicker(reminderPollInterval)
+	defer ticker.Stop()
+
+	for {
+		dispatchDueReminders(tg, db)
+		<-ticker.C
+	}
+}
+
+func dispatchDueReminders(tg *telegram.Client, db *sql.DB) {
+	now := time.Now().Unix()
+
+	due, err := database.GetDueReminders(db, now, reminderBatchSize)
+	if err != nil {
+		slog.Error("get due reminders error", "err", err)
+		return
+	}
+
+	for _, r := range due {
+		// сначала помечаем отправленным — так напоминание не уйдёт дважды
+		claimed, err := database.ClaimReminder(db, r.ID, now)
+		if err != nil {
+			slog.Error("claim reminder error", "reminder_id", r.ID, "err", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		// бот мог лежать: если занятие уже началось, напоминать поздно
+		if r.StartTS <= now {
+			continue
+		}
+
+		if err := tg.SendMessage(r.RecipientChatID, reminderText(r)); err != nil {
+			// заблокировал бота — повторять бесполезно
+			if markIfBlocked(db, r.RecipientChatID, err) {
+				continue
+			}
+			slog.Error("send reminder error", "reminder_id", r.ID, "chat_id", r.RecipientChatID, "attempt", r.Attempts+1, "err", err)
+			if !telegram.IsNotSent(err) {
+				// напоминание могло дойти (таймаут после отправки) — повтор его задвоит
+				continue
+			}
+			if r.Attempts+1 >= reminderMaxAttempts {
+				// так и остаётся помеченным отправленным — больше не пробуем
+				slog.Warn("reminder given up", "reminder_id", r.ID, "chat_id", r.RecipientChatID, "attempts", r.Attempts+1)
+				continue
+			}
+			nextTry := now + int64(reminderRetryDelay/time.Second)<<r.Attempts
+			if err := database.ReleaseReminder(db, r.ID, nextTry); err != nil {
+				slog.Error("release reminder error", "reminder_id", r.ID, "err", err)
+			}
+		}
+	}
+}
+
+func reminderText(r database.Reminder) string {
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	start := time.Unix(r.StartTS, 0).In(loc)
+
+	text := "⏰ Напоминание о занятии\n"
+	if m, err := strconv.Atoi(strings.TrimPrefix(r.Kind, "before:")); err == nil {
+		text = "⏰ Через " + leadLabel(m) + " занятие\n"
+	}
+	return text +
+		"Дата/время: " + start.Format("02.01.2006 15:04") + "\n" +
+		"Длительность: " + strconv.Itoa(r.DurationMin) + " мин"
+}
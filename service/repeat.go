@@ -0,0 +1,420 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Повторы записи. В сессии правило хранится строкой (database.Recurrence.String()),
+// "" — разовая запись. Пресеты «каждую неделю на N месяцев» — частные случаи правила.
+// Кнопки конструктора: rep_custom, rep_day:<weekday>, rep_int:<недель>, rep_end, rep_preview, rep_back;
+// на экране подтверждения серии с занятыми датами — rep_conflict:skip / rep_conflict:shift
+
+// bookingStart — начало записи из сессии (по Москве)
+func bookingStart(st *BookingState) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", st.Date+" "+st.Time, time.FixedZone("Europe/Moscow", 3*3600))
+}
+
+// presetRule: каждую неделю в день первого занятия, months месяцев; 0 — разово
+func presetRule(start time.Time, months int) string {
+	if months == 0 {
+		return ""
+	}
+	return database.Recurrence{
+		Interval: 1,
+		Weekdays: []time.Weekday{start.Weekday()},
+		Until:    start.AddDate(0, months, 0).Format("2006-01-02"),
+	}.String()
+}
+
+// bookingRule — правило из сессии; пустое правило конструктора — каждую неделю в день
+// первого занятия на месяц
+func bookingRule(st *BookingState, start time.Time) database.Recurrence {
+	if st.Repeat != "" {
+		if r, err := database.ParseRule(st.Repeat); err == nil {
+			return r
+		}
+	}
+	r, _ := database.ParseRule(presetRule(start, 1))
+	return r
+}
+
+// weeksLabel: "каждую неделю", "каждые 2 недели", "каждые 5 недель"
+func weeksLabel(n int) string {
+	if n <= 1 {
+		return "каждую неделю"
+	}
+	return "каждые " + strconv.Itoa(n) + " " + plural(n, "неделю", "недели", "недель")
+}
+
+// plural: 1 неделю, 2 недели, 5 недель
+func plural(n int, one, few, many string) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return one
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return few
+	default:
+		return many
+	}
+}
+
+// weekdaysLabel: "Пн, Чт"
+func weekdaysLabel(days []time.Weekday) string {
+	var names []string
+	for _, wd := range days {
+		names = append(names, weekdayShort[wd])
+	}
+	return strings.Join(names, ", ")
+}
+
+// repeatLabel: "каждые 2 недели по Пн, Чт до 16.12.2026"
+func repeatLabel(r database.Recurrence, start time.Time) string {
+	days := r.Weekdays
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+	s := weeksLabel(r.Interval) + " по " + weekdaysLabel(days)
+	if r.Until != "" {
+		if d, err := time.Parse("2006-01-02", r.Until); err == nil {
+			s += " до " + d.Format("02.01.2006")
+		}
+	}
+	if r.Count > 0 {
+		s += ", всего занятий: " + strconv.Itoa(r.Count)
+	}
+	return s
+}
+
+// RepeatBuilderKeyboard — дни недели, периодичность, окончание
+func RepeatBuilderKeyboard(r database.Recurrence) *telegram.InlineKeyboardMarkup {
+	mark := func(on bool, text string) string {
+		if on {
+			return "✅ " + text
+		}
+		return text
+	}
+
+	var rows [][]telegram.InlineKeyboardButton
+	var row []telegram.InlineKeyboardButton
+	for _, wd := range weekdaysOrder {
+		row = append(row, telegram.InlineKeyboardButton{
+			Text:         mark(r.Has(wd), weekdayShort[wd]),
+			CallbackData: "rep_day:" + strconv.Itoa(int(wd)),
+		})
+		// 4 + 3
+		if len(row) == 4 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	rows = append(rows, row)
+
+	row = nil
+	for n := 1; n <= 4; n++ {
+		row = append(row, telegram.InlineKeyboardButton{
+			Text:         mark(r.Interval == n, strconv.Itoa(n)+" нед."),
+			CallbackData: "rep_int:" + strconv.Itoa(n),
+		})
+	}
+	rows = append(rows, row)
+
+	rows = append(rows,
+		[]telegram.InlineKeyboardButton{{Text: "📅 Окончание: дата или число занятий", CallbackData: "rep_end"}},
+		[]telegram.InlineKeyboardButton{{Text: "👁 Показать даты", CallbackData: "rep_preview"}},
+		[]telegram.InlineKeyboardButton{
+			{Text: "⟵ Назад", CallbackData: "rep_back"},
+			{Text: "Отмена", CallbackData: "booking_cancel"},
+		},
+	)
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// repeatBuilderText — описание правила над кнопками конструктора
+func repeatBuilderText(st *BookingState, r database.Recurrence, start time.Time) string {
+	return bookingSummary(st) + "\n\n" +
+		"🔁 " + repeatLabel(r, start) + "\n\n" +
+		"Отметьте дни недели и периодичность (раз в сколько недель), задайте окончание и нажмите «Показать даты»."
+}
+
+// repeatSession — сессия записи с выбранным временем; иначе кнопка из старого сообщения
+func repeatSession(c *Ctx) (*BookingState, time.Time, bool) {
+	st := &c.Sess.Booking
+	if st.TeacherID == 0 || st.Date == "" || st.Time == "" || st.DurationMin == 0 {
+		bookingExpired(c)
+		return nil, time.Time{}, false
+	}
+	start, err := bookingStart(st)
+	if err != nil {
+		bookingExpired(c)
+		return nil, time.Time{}, false
+	}
+	return st, start, true
+}
+
+// rep_custom — открыть конструктор повтора (правило из сессии сохраняется)
+func handleRepeatCustom(c *Ctx) {
+	st, start, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	r := bookingRule(st, start)
+	st.Repeat = r.String()
+	st.Step = "pick_repeat"
+	st.MsgID = c.MsgID
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, repeatBuilderText(st, r, start), RepeatBuilderKeyboard(r))
+}
+
+// rep_day:<weekday> — отметить / снять день недели
+func handleRepeatDay(c *Ctx) {
+	wd, err := strconv.Atoi(strings.TrimPrefix(c.Data, "rep_day:"))
+	if err != nil || wd < 0 || wd > 6 {
+		return
+	}
+	st, start, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	r := bookingRule(st, start)
+	r.Toggle(time.Weekday(wd))
+	if len(r.Weekdays) == 0 {
+		// хотя бы один день должен остаться
+		return
+	}
+	editRepeatBuilder(c, st, r, start)
+}
+
+// rep_int:<недель>
+func handleRepeatInterval(c *Ctx) {
+	n, err := strconv.Atoi(strings.TrimPrefix(c.Data, "rep_int:"))
+	if err != nil || n < 1 || n > 4 {
+		return
+	}
+	st, start, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	r := bookingRule(st, start)
+	if r.Interval == n {
+		return
+	}
+	r.Interval = n
+	editRepeatBuilder(c, st, r, start)
+}
+
+func editRepeatBuilder(c *Ctx, st *BookingState, r database.Recurrence, start time.Time) {
+	st.Repeat = r.String()
+	st.MsgID = c.MsgID
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, repeatBuilderText(st, r, start), RepeatBuilderKeyboard(r))
+}
+
+// rep_end — окончание серии вводится текстом
+func handleRepeatEnd(c *Ctx) {
+	st, _, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	st.Step = "pick_repeat_end"
+	st.MsgID = 0
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID,
+		"Введите дату последнего занятия (например, 31.12.2026) или число занятий (например, 10).", nil)
+}
+
+// шаг pick_repeat_end: "31.12.2026" или "10"
+func handleRepeatEndInput(c *Ctx) {
+	st, start, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	r := bookingRule(st, start)
+	text := strings.TrimSpace(c.Text)
+
+	if n, err := strconv.Atoi(text); err == nil {
+		if n < 1 || n > database.MaxOccurrences {
+			_ = c.TG.SendMessage(c.ChatID, "Число занятий — от 1 до "+strconv.Itoa(database.MaxOccurrences))
+			return
+		}
+		r.Count = n
+		r.Until = ""
+	} else {
+		loc := time.FixedZone("Europe/Moscow", 3*3600)
+		d, err := time.ParseInLocation("02.01.2006", text, loc)
+		if err != nil {
+			_ = c.TG.SendMessage(c.ChatID, "Неверный формат. Пример: 31.12.2026 или 10")
+			return
+		}
+		if d.Format("2006-01-02") < st.Date {
+			_ = c.TG.SendMessage(c.ChatID, "Дата окончания раньше первого занятия")
+			return
+		}
+		if d.After(start.AddDate(0, database.MaxSeriesMonths, 0)) {
+			_ = c.TG.SendMessage(c.ChatID, "Серию можно создать не больше чем на "+strconv.Itoa(database.MaxSeriesMonths)+" месяцев")
+			return
+		}
+		r.Until = d.Format("2006-01-02")
+		r.Count = 0
+	}
+
+	st.Repeat = r.String()
+	st.Step = "pick_repeat"
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, repeatBuilderText(st, r, start), RepeatBuilderKeyboard(r))
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+// rep_preview — даты серии и подтверждение
+func handleRepeatPreview(c *Ctx) {
+	st, start, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	r := bookingRule(st, start)
+	st.Repeat = r.String()
+	st.MsgID = c.MsgID
+
+	if len(r.Occurrences(start)) == 0 {
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID,
+			repeatBuilderText(st, r, start)+"\n\n❗ По этим настройкам не выходит ни одного занятия.", RepeatBuilderKeyboard(r))
+		return
+	}
+	st.Step = "confirm"
+	text, kb := confirmScreen(c, st, start)
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, kb)
+}
+
+// rep_back — из конструктора обратно к пресетам
+func handleRepeatBack(c *Ctx) {
+	st, _, ok := repeatSession(c)
+	if !ok {
+		return
+	}
+	st.Repeat = ""
+	st.Step = "pick_repeat"
+	st.MsgID = c.MsgID
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, bookingSummary(st)+"\nКак записать?", RepeatKeyboard())
+}
+
+// plannedLesson — занятие будущей серии с результатом проверки
+type plannedLesson struct {
+	Start   time.Time
+	Problem string    // "" — свободно, иначе почему записаться нельзя
+	Shift   time.Time // ближайшее свободное время в тот же день; нулевое — его нет
+}
+
+// planSeries проверяет даты серии ученика chatID по рабочему времени, недоступности и записям преподавателя
+func planSeries(db *sql.DB, teacherID int64, chatID int64, dates []time.Time, durationMin int) ([]plannedLesson, error) {
+	if len(dates) == 0 {
+		return nil, nil
+	}
+	blocked, err := database.GetBlockedPeriods(db, teacherID, dates[0].Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []plannedLesson
+	for _, t := range dates {
+		slots, err := daySlots(db, teacherID, chatID, t.Format("2006-01-02"), durationMin, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		min := t.Hour()*60 + t.Minute()
+		l := plannedLesson{Start: t, Problem: "преподаватель не работает"}
+		if blocked.Blocks(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), min, durationMin) {
+			l.Problem = "преподаватель недоступен"
+		}
+		for _, s := range slots {
+			if s.Min == min {
+				l.Problem = ""
+				if s.Busy {
+					l.Problem = "занято"
+				}
+			}
+		}
+
+		if l.Problem != "" {
+			best := -1
+			for _, s := range slots {
+				if !s.Busy && (best < 0 || abs(s.Min-min) < abs(best-min)) {
+					best = s.Min
+				}
+			}
+			if best >= 0 {
+				day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+				l.Shift = day.Add(time.Duration(best) * time.Minute)
+			}
+		}
+		plan = append(plan, l)
+	}
+	return plan, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// confirmScreen — что будет создано: одно занятие или даты серии с пометками о занятых,
+// и кнопки: подтвердить, а если есть занятые даты — пропустить их или перенести
+func confirmScreen(c *Ctx, st *BookingState, start time.Time) (string, *telegram.InlineKeyboardMarkup) {
+	if st.Repeat == "" {
+		return bookingSummary(st) + "\n\nПодтвердить запись?", ConfirmKeyboard()
+	}
+
+	r := bookingRule(st, start)
+	plan, err := planSeries(c.DB, st.TeacherID, bookingChatID(c, st), r.Occurrences(start), st.DurationMin)
+	if err != nil {
+		slog.Error("plan series error", "err", err)
+		return "Ошибка чтения базы данных", nil
+	}
+
+	var b strings.Builder
+	b.WriteString(bookingSummary(st) + "\n")
+	b.WriteString("🔁 " + repeatLabel(r, start) + "\n\n")
+	b.WriteString("Даты (" + strconv.Itoa(len(plan)) + "):")
+	free, shiftable := 0, 0
+	for _, l := range plan {
+		b.WriteString("\n" + weekdayShort[l.Start.Weekday()] + " " + l.Start.Format("02.01.2006 15:04"))
+		if l.Problem == "" {
+			free++
+			continue
+		}
+		b.WriteString(" — ❌ " + l.Problem)
+		if !l.Shift.IsZero() {
+			shiftable++
+			b.WriteString(" (свободно в " + l.Shift.Format("15:04") + ")")
+		}
+	}
+
+	edit := []telegram.InlineKeyboardButton{{Text: "⚙️ Изменить повтор", CallbackData: "rep_custom"}}
+	if free == len(plan) {
+		b.WriteString("\n\nПодтвердить запись?")
+		kb := ConfirmKeyboard()
+		kb.InlineKeyboard = append(kb.InlineKeyboard, edit)
+		return b.String(), kb
+	}
+
+	b.WriteString("\n\nСвободно: " + strconv.Itoa(free) + " из " + strconv.Itoa(len(plan)) + ".")
+	var rows [][]telegram.InlineKeyboardButton
+	if free > 0 {
+		rows = append(rows, []telegram.InlineKeyboardButton{{Text: "⏭ Записать без занятых дат", CallbackData: "rep_conflict:" + seriesSkipBusy}})
+	}
+	if shiftable > 0 {
+		rows = append(rows, []telegram.InlineKeyboardButton{{Text: "↔️ Перенести занятые на свободное время", CallbackData: "rep_conflict:" + seriesShiftBusy}})
+	}
+	if len(rows) == 0 {
+		b.WriteString(" Измените повтор или выберите другое время.")
+	} else {
+		b.WriteString(" Что сделать с занятыми датами?")
+	}
+	rows = append(rows, edit, []telegram.InlineKeyboardButton{{Text: "❌ Отменить запись", CallbackData: "confirm_no"}})
+	return b.String(), &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Перенос записи идёт по шагам обычной записи (календарь → время → подтверждение)
+// с BookingState.MoveID; сама запись меняется одной транзакцией только после подтверждения,
+// так что старое время не теряется, пока новое не занято.
+
+// «Перенести запись» — ученик выбирает, какую
+func handleMoveMenu(c *Ctx) {
+	sendFutureAppointments(c, "Выберите запись для переноса:", func(a database.Appointment, when string) telegram.InlineKeyboardButton {
+		return telegram.InlineKeyboardButton{Text: "↔️ " + when, CallbackData: "move_app:" + strconv.FormatInt(a.ID, 10)}
+	})
+}
+
+// move_app:<id> — перенос учеником
+func handleStudentMove(c *Ctx) {
+	a, ok := moveTarget(c, strings.TrimPrefix(c.Data, "move_app:"))
+	if !ok {
+		return
+	}
+	if a.StudentChatID != c.ChatID {
+		_ = c.TG.SendMessage(c.ChatID, "Запись не найдена")
+		return
+	}
+	startMove(c, a, false)
+}
+
+// t_move_app:<id> — перенос преподавателем
+func handleTeacherMove(c *Ctx) {
+	a, ok := moveTarget(c, strings.TrimPrefix(c.Data, "t_move_app:"))
+	if !ok {
+		return
+	}
+	if a.TeacherID != currentTeacherID(c.ChatID) {
+		_ = c.TG.SendMessage(c.ChatID, "Запись не найдена")
+		return
+	}
+	startMove(c, a, true)
+}
+
+// moveTarget — будущая запись по id из кнопки
+func moveTarget(c *Ctx, idStr string) (database.Appointment, bool) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return database.Appointment{}, false
+	}
+	a, ok, err := database.GetAppointment(c.DB, id)
+	if err != nil {
+		slog.Error("get appointment error", "appointment_id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return database.Appointment{}, false
+	}
+	if !ok || a.StartTS <= time.Now().Unix() {
+		_ = c.TG.SendMessage(c.ChatID, "Запись не найдена: её уже отменили или она прошла")
+		return database.Appointment{}, false
+	}
+	return a, true
+}
+
+// startMove показывает календарь преподавателя записи для выбора нового дня
+func startMove(c *Ctx, a database.Appointment, byTeacher bool) {
+	st := &c.Sess.Booking
+	if st.MsgID != 0 {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, st.MsgID, nil)
+	}
+	*st = BookingState{
+		Step:          "pick_date",
+		TeacherID:     a.TeacherID,
+		DurationMin:   a.DurationMin,
+		MoveID:        a.ID,
+		MoveFromTS:    a.StartTS,
+		MoveByTeacher: byTeacher,
+	}
+
+	text := "Перенос занятия " + moveWhen(a.StartTS) + " (" + strconv.Itoa(a.DurationMin) + " мин)"
+	if byTeacher {
+		text += "\nУченик: " + a.StudentName
+	}
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, text+"\nВыберите новую дату:", tutorCalendar(c, a.TeacherID))
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+func moveWhen(ts int64) string {
+	return time.Unix(ts, 0).In(time.FixedZone("Europe/Moscow", 3*3600)).Format("02.01.2006 15:04")
+}
+
+// moveSummary — текст подтверждения переноса
+func moveSummary(st *BookingState) string {
+	to := st.Date + " " + st.Time
+	if start, err := bookingStart(st); err == nil {
+		to = start.Format("02.01.2006 15:04")
+	}
+	return "Перенести занятие?\n" +
+		"Было: " + moveWhen(st.MoveFromTS) + "\n" +
+		"Станет: " + to + " (" + strconv.Itoa(st.DurationMin) + " мин)"
+}
+
+// moveAborted — «нет» на подтверждении переноса: запись не меняется
+func moveAborted(st BookingState) string {
+	return "Перенос отменён, занятие остаётся " + moveWhen(st.MoveFromTS)
+}
+
+// moveAppointment переносит запись st.MoveID на start и сообщает другой стороне
+func moveAppointment(c *Ctx, st BookingState, start time.Time) {
+	a, ok, err := database.GetAppointment(c.DB, st.MoveID)
+	if err != nil {
+		slog.Error("get appointment error", "appointment_id", st.MoveID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	// владелец проверяется ещё раз: сессия могла пережить выход преподавателя
+	owner := a.StudentChatID == c.ChatID
+	if st.MoveByTeacher {
+		owner = a.TeacherID == currentTeacherID(c.ChatID)
+	}
+	if !ok || !owner || a.StartTS != st.MoveFromTS {
+		_ = c.TG.SendMessage(c.ChatID, "❌ Запись уже изменилась или отменена, перенос не выполнен")
+		return
+	}
+
+	moved, err := database.RescheduleAppointmentTx(c.DB, a, start.Unix())
+	switch {
+	case err == database.ErrSlotBusy:
+		_ = c.TG.SendMessage(c.ChatID, "❌ Это время уже занято, запись осталась на "+moveWhen(a.StartTS))
+		return
+	case err == database.ErrOutsideWorkingHours:
+		_ = c.TG.SendMessage(c.ChatID, "❌ В это время преподаватель не работает, запись осталась на "+moveWhen(a.StartTS))
+		return
+	case err == database.ErrBlockedPeriod:
+		_ = c.TG.SendMessage(c.ChatID, "❌ В это время преподаватель недоступен, запись осталась на "+moveWhen(a.StartTS))
+		return
+	case err == database.ErrAppointmentChanged:
+		_ = c.TG.SendMessage(c.ChatID, "❌ Запись уже изменилась или отменена, перенос не выполнен")
+		return
+	case err != nil:
+		slog.Error("reschedule appointment error", "appointment_id", a.ID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка записи в базу данных")
+		return
+	}
+
+	change := moveWhen(a.StartTS) + " → " + moveWhen(moved.StartTS)
+	_ = c.TG.SendMessage(c.ChatID, "✅ Занятие перенесено: "+change)
+	offerFreedSlot(c.TG, c.DB, a.TeacherID, a.StartTS)
+
+	if st.MoveByTeacher {
+		notifyStudent(c.TG, c.DB, a.StudentChatID, "↔️ Преподаватель перенёс занятие: "+change)
+		return
+	}
+	notifyTeacher(c.TG, c.DB, a.TeacherID, "↔️ Перенос занятия\n"+
+		"Ученик: "+a.StudentName+"\n"+
+		"Было: "+moveWhen(a.StartTS)+"\n"+
+		"Стало: "+moveWhen(moved.StartTS)+"\n"+
+		"Длительность: "+strconv.Itoa(a.DurationMin)+" мин")
+}
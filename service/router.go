@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bot/telegram"
+	"database/sql"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Ctx — одно входящее обновление и всё, что нужно обработчику
+type Ctx struct {
+	TG     *telegram.Client
+	DB     *sql.DB
+	Update telegram.Update
+	ChatID int64
+
+	// Состояние диалога; сохраняется после обработки
+	Sess *Session
+
+	Text  string // текст сообщения
+	Data  string // data нажатой inline-кнопки
+	MsgID int    // сообщение, под которым нажали кнопку
+
+	// Какой обработчик выбран (для логов), например "text:записаться"
+	Route string
+}
+
+// IsCallback — обновление пришло от inline-кнопки
+func (c *Ctx) IsCallback() bool {
+	return c.Update.CallbackQuery != nil
+}
+
+type HandlerFunc func(c *Ctx)
+
+// Middleware оборачивает обработчик: проверки, логи, восстановление после паники
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Router выбирает обработчик для обновления.
+//
+// Callback-кнопки сопоставляются по префиксу data (выигрывает самый длинный).
+// Для сообщений порядок такой: команда (/start) → кнопка меню (точный текст) →
+// текущий шаг диалога → Fallback. Кнопки меню видны всегда, поэтому они
+// прерывают незаконченный шаг, а свободный ввод достаётся шагу.
+// Исключение — шаги с произвольным текстом (FreeStep: пароль, причина отмены):
+// им достаётся любой текст, кроме команд, даже «нет» или «отмена».
+type Router struct {
+	commands  map[string]HandlerFunc
+	texts     map[string]HandlerFunc
+	steps     map[string]HandlerFunc
+	freeSteps map[string]bool
+	callbacks []callbackRoute
+	fallback  HandlerFunc
+	mw        []Middleware
+}
+
+type callbackRoute struct {
+	prefix string
+	h      HandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{
+		commands:  make(map[string]HandlerFunc),
+		texts:     make(map[string]HandlerFunc),
+		steps:     make(map[string]HandlerFunc),
+		freeSteps: make(map[string]bool),
+	}
+}
+
+// Use добавляет middleware для всех обработчиков (первый — самый внешний)
+func (r *Router) Use(mw ...Middleware) {
+	r.mw = append(r.mw, mw...)
+}
+
+// Command — команда вида "/start" (суффикс "@botname" отбрасывается)
+func (r *Router) Command(cmd string, h HandlerFunc, mw ...Middleware) {
+	r.commands[cmd] = chain(h, mw...)
+}
+
+// Text — точный текст сообщения (кнопка reply-клавиатуры), без учёта регистра
+func (r *Router) Text(text string, h HandlerFunc, mw ...Middleware) {
+	r.texts[normalizeText(text)] = chain(h, mw...)
+}
+
+// Callback — data inline-кнопки, равная prefix или начинающаяся с него
+func (r *Router) Callback(prefix string, h HandlerFunc, mw ...Middleware) {
+	r.callbacks = append(r.callbacks, callbackRoute{prefix: prefix, h: chain(h, mw...)})
+}
+
+// Step — свободный ввод на шаге диалога (см. Session.step)
+func (r *Router) Step(step string, h HandlerFunc, mw ...Middleware) {
+	r.steps[step] = chain(h, mw...)
+}
+
+// FreeStep — шаг, на котором любой текст (кроме команд) — это ввод: кнопки меню и
+// «отмена» его не прерывают. Выйти из такого шага — inline-кнопкой или /start.
+func (r *Router) FreeStep(step string, h HandlerFunc, mw ...Middleware) {
+	r.Step(step, h, mw...)
+	r.freeSteps[step] = true
+}
+
+// Fallback — сообщение, которое никто не обработал
+func (r *Router) Fallback(h HandlerFunc, mw ...Middleware) {
+	r.fallback = chain(h, mw...)
+}
+
+// Dispatch находит обработчик и вызывает его через общие middleware.
+// Неизвестные callback-кнопки молча игнорируются.
+func (r *Router) Dispatch(c *Ctx) {
+	h, route := r.match(c)
+	if h == nil {
+		return
+	}
+	c.Route = route
+	chain(h, r.mw...)(c)
+}
+
+func (r *Router) match(c *Ctx) (HandlerFunc, string) {
+	if c.IsCallback() {
+		var best *callbackRoute
+		for i := range r.callbacks {
+			cr := &r.callbacks[i]
+			if strings.HasPrefix(c.Data, cr.prefix) && (best == nil || len(cr.prefix) > len(best.prefix)) {
+				best = cr
+			}
+		}
+		if best == nil {
+			return nil, ""
+		}
+		return best.h, "callback:" + best.prefix
+	}
+
+	if cmd, ok := commandName(c.Text); ok {
+		if h, ok := r.commands[cmd]; ok {
+			return h, "command:" + cmd
+		}
+	}
+	step := c.Sess.step()
+	if r.freeSteps[step] {
+		return r.steps[step], "step:" + step
+	}
+	if key := normalizeText(c.Text); key != "" {
+		if h, ok := r.texts[key]; ok {
+			return h, "text:" + key
+		}
+	}
+	if step != "" {
+		if h, ok := r.steps[step]; ok {
+			return h, "step:" + step
+		}
+	}
+	return r.fallback, "fallback"
+}
+
+func chain(h HandlerFunc, mw ...Middleware) HandlerFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+func normalizeText(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// commandName: "/start@my_bot arg" -> "/start"
+func commandName(text string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", false
+	}
+	cmd, _, _ := strings.Cut(fields[0], "@")
+	return cmd, true
+}
+
+// recoverPanics не даёт упавшему обработчику уронить бота.
+// Диалог при этом сбрасывается — он мог остаться в полуготовом состоянии.
+func recoverPanics(next HandlerFunc) HandlerFunc {
+	return func(c *Ctx) {
+		defer func() {
+			if p := recover(); p != nil {
+				slog.Error("handler panic", "chat_id", c.ChatID, "route", c.Route, "panic", p, "stack", string(debug.Stack()))
+				*c.Sess = Session{}
+				_ = c.TG.SendMessage(c.ChatID, "Что-то пошло не так. Попробуйте ещё раз или нажмите /start")
+			}
+		}()
+		next(c)
+	}
+}
+
+// logUpdates пишет, какой обработчик сработал и сколько он занял.
+// Текст сообщения не логируем — там может быть пароль.
+func logUpdates(next HandlerFunc) HandlerFunc {
+	return func(c *Ctx) {
+		start := time.Now()
+		next(c)
+		slog.Info("update handled", "chat_id", c.ChatID, "route", c.Route, "took", time.Since(start))
+	}
+}
+
+// teacherOnly пропускает только вошедшего преподавателя
+func teacherOnly(next HandlerFunc) HandlerFunc {
+	return func(c *Ctx) {
+		if !isTeacher(c.DB, c.ChatID) {
+			_ = c.TG.SendMessage(c.ChatID, "Сначала войдите как преподаватель.")
+			return
+		}
+		next(c)
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+// router — обработчики бота; собирается один раз при старте
+var router = newBotRouter()
+
+func newBotRouter() *Router {
+	r := NewRouter()
+	r.Use(recoverPanics, logUpdates)
+
+	// общее
+	r.Command("/start", handleStart)
+	r.Text("Назад", handleStart)
+	r.Fallback(handleUnknown)
+
+	// ученик
+	r.Text("Ученик", handleStudentRole)
+	r.Step("wait_name", handleStudentName)
+	r.Text("Мои записи", handleMyAppointments)
+	r.Text("Отменить запись", handleCancelMenu)
+	r.Callback("cancel_app:", handleStudentCancel)
+	r.Callback("cancel_yes:", handleStudentCancelConfirm)
+	r.Callback("cancel_why:", handleStudentCancelWhy)
+	r.Callback("cancel_keep", handleStudentCancelKeep)
+	r.FreeStep("cancel_reason", handleStudentCancelReason)
+	r.Callback("rebook:", handleRebook)
+	r.Text("Перенести запись", handleMoveMenu)
+	r.Callback("move_app:", handleStudentMove)
+	r.Text("Мои серии", handleMySeries)
+	r.Callback("ser:", seriesHandler(studentSeries))
+	r.Text("Настройки", sendSettings)
+	r.Callback("set:", handleSettingsCallback)
+
+	// запись на занятие: преподаватель → день → длительность → время → повторы → подтверждение;
+	// перенос записи (move_app / t_move_app) идёт по тем же шагам: день → время → подтверждение
+	r.Text("Записаться", handleBookingStart)
+	for _, w := range []string{"нет", "отмена", "cancel"} {
+		r.Text(w, handleBookingAbort)
+	}
+	r.Callback("booking_cancel", handleBookingCancel)
+	r.Callback("tutor:", handleTutorPick)
+	r.Step("pick_tutor", handleTutorInput)
+	r.Callback("cal:", handleCalendar)
+	r.Callback("dur_pick:", handleDurationPick)
+	r.Step("pick_duration", handleDurationInput)
+	r.Callback("time_page:", handleTimePage)
+	r.Callback("time_pick:", handleTimePick)
+	r.Callback("time_manual:", handleTimeManual)
+	r.Callback("time_cal", handleTimeBack)
+	r.Step("pick_time", handleDateTimeInput)
+	r.Step("pick_time_manual", handleTimeManualInput)
+	r.Callback("rep_pick:", handleRepeatPick)
+	r.Callback("rep_custom", handleRepeatCustom)
+	r.Callback("rep_day:", handleRepeatDay)
+	r.Callback("rep_int:", handleRepeatInterval)
+	r.Callback("rep_end", handleRepeatEnd)
+	r.Callback("rep_preview", handleRepeatPreview)
+	r.Callback("rep_back", handleRepeatBack)
+	r.Step("pick_repeat", handleRepeatInput)
+	r.Step("pick_repeat_end", handleRepeatEndInput)
+	r.Callback("confirm_yes", handleConfirmYes)
+	r.Callback("confirm_no", handleConfirmNo)
+	r.Callback("rep_conflict:", handleConflictPick)
+	r.Step("confirm", handleConfirmInput)
+
+	// лист ожидания: занятое время → очередь → предложение освободившегося времени
+	r.Callback("wl_join:", handleWaitlistJoin)
+	r.Callback("wl_book:", handleWaitlistBook)
+	r.Callback("wl_leave:", handleWaitlistLeave)
+
+	// преподаватель
+	r.Text("Преподаватель", handleTeacherRole)
+	r.FreeStep("login", handleTeacherLogin)
+	r.FreeStep("password", handleTeacherPassword)
+	r.Command("/logout", handleTeacherLogout)
+	r.Text("Выйти", handleTeacherLogout)
+	r.Command("/day", handleTeacherDays, teacherOnly)
+	r.Text("Посмотреть записи", handleTeacherDays, teacherOnly)
+	r.Text("Записи по дням", handleTeacherDays, teacherOnly)
+	r.Callback("t_cancel_app:", handleTeacherCancel, teacherOnly)
+	r.Callback("t_cancel_yes:", handleTeacherCancelConfirm, teacherOnly)
+	r.Callback("t_cancel_why:", handleTeacherCancelWhy, teacherOnly)
+	r.Callback("t_cancel_no", handleTeacherCancelKeep, teacherOnly)
+	r.FreeStep("t_cancel_reason", handleTeacherCancelReason, teacherOnly)
+	r.Callback("t_move_app:", handleTeacherMove, teacherOnly)
+	r.Text("Записать ученика", handleTeacherBook, teacherOnly)
+	r.Callback("t_book_page:", handleTeacherBookPage, teacherOnly)
+	r.Callback("t_book_st:", handleTeacherBookStudent, teacherOnly)
+	r.Callback("t_book_new", handleTeacherBookNew, teacherOnly)
+	r.Step("t_book_name", handleTeacherBookName, teacherOnly)
+	r.Text("Поздние отмены", handleLateCancellations, teacherOnly)
+	r.Callback("t_waive:", handleWaiveCancel, teacherOnly)
+	r.Text("Серии", handleTeacherSeriesList, teacherOnly)
+	r.Callback("t_ser:", seriesHandler(teacherSeries), teacherOnly)
+	r.Text("Рабочее время", handleWorkingHours, teacherOnly)
+	r.Callback("wh:", handleWorkingHoursCallback, teacherOnly)
+	r.Step("wh_day", handleWorkingDayInput, teacherOnly)
+	r.Step("wh_exception", handleWorkingExceptionInput, teacherOnly)
+	r.Text("Отпуск и перерывы", handleBlockedPeriods, teacherOnly)
+	r.Callback("bp:", handleBlockedPeriodsCallback, teacherOnly)
+	r.Step("bp_add", handleBlockedPeriodInput, teacherOnly)
+
+	return r
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seriesRole — чем просмотр серий ученика отличается от просмотра преподавателя.
+// Кнопки: <prefix>:list, <prefix>:view:<id>, <prefix>:skip:<id>:<app_id>,
+// <prefix>:cancel:<id>, <prefix>:cancel_yes:<id>
+type seriesRole struct {
+	prefix string
+	empty  string
+
+	// list — действующие серии этого пользователя
+	list func(c *Ctx) ([]database.Series, error)
+
+	// owns — может ли пользователь менять серию
+	owns func(c *Ctx, s database.Series) bool
+
+	// label — кнопка серии в списке
+	label func(s database.Series) string
+
+	// party — строка про другую сторону в карточке серии
+	party func(c *Ctx, s database.Series) string
+
+	// notify — сообщить другой стороне
+	notify func(c *Ctx, s database.Series, text string)
+
+	// terms — правила отмены занятий для этой стороны
+	terms func() database.CancelTerms
+}
+
+var studentSeries = seriesRole{
+	prefix: "ser",
+	empty:  "У вас нет повторяющихся занятий",
+	list: func(c *Ctx) ([]database.Series, error) {
+		return database.GetStudentSeries(c.DB, c.ChatID)
+	},
+	owns: func(c *Ctx, s database.Series) bool {
+		return s.StudentChatID == c.ChatID
+	},
+	label: seriesRuleLabel,
+	party: func(c *Ctx, s database.Series) string {
+		t, ok, err := database.GetTeacher(c.DB, s.TeacherID)
+		if err != nil || !ok {
+			return ""
+		}
+		return "Преподаватель: " + t.DisplayName() + "\n"
+	},
+	notify: func(c *Ctx, s database.Series, text string) {
+		notifyTeacher(c.TG, c.DB, s.TeacherID, text+"\nУченик: "+s.StudentName)
+	},
+	terms: studentCancelTerms,
+}
+
+var teacherSeries = seriesRole{
+	prefix: "t_ser",
+	empty:  "Повторяющихся занятий нет",
+	list: func(c *Ctx) ([]database.Series, error) {
+		return database.GetTeacherSeries(c.DB, currentTeacherID(c.ChatID))
+	},
+	owns: func(c *Ctx, s database.Series) bool {
+		return s.TeacherID == currentTeacherID(c.ChatID)
+	},
+	label: func(s database.Series) string {
+		return s.StudentName + " — " + seriesRuleLabel(s)
+	},
+	party: func(c *Ctx, s database.Series) string {
+		return "Ученик: " + s.StudentName + "\n"
+	},
+	notify: func(c *Ctx, s database.Series, text string) {
+		notifyStudent(c.TG, c.DB, s.StudentChatID, text+"\n(изменение внёс преподаватель)")
+	},
+	terms: teacherCancelTerms,
+}
+
+// seriesRuleLabel: "Вт 17:30, 60 мин" или "Пн, Чт 17:30, 60 мин, каждые 2 недели"
+func seriesRuleLabel(s database.Series) string {
+	start := time.Unix(s.StartTS, 0).In(time.FixedZone("Europe/Moscow", 3*3600))
+	r, err := database.ParseRule(s.Rule)
+	if err != nil {
+		slog.Warn("bad series rule", "series_id", s.ID, "rule", s.Rule, "err", err)
+		r = database.Recurrence{Interval: 1}
+	}
+	days := r.Weekdays
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+
+	label := weekdaysLabel(days) + " " + start.Format("15:04") + ", " + strconv.Itoa(s.DurationMin) + " мин"
+	if r.Interval > 1 {
+		label += ", " + weeksLabel(r.Interval)
+	}
+	return label
+}
+
+// «Мои серии» — ученик
+func handleMySeries(c *Ctx) {
+	sendSeriesList(c, studentSeries, 0)
+}
+
+// «Серии» — преподаватель
+func handleTeacherSeriesList(c *Ctx) {
+	sendSeriesList(c, teacherSeries, 0)
+}
+
+// sendSeriesList присылает список серий (или, если msgID != 0, показывает его в этом сообщении)
+func sendSeriesList(c *Ctx, role seriesRole, msgID int) {
+	list, err := role.list(c)
+	if err != nil {
+		slog.Error("get series error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+
+	text := "Повторяющиеся занятия (нажмите, чтобы посмотреть):"
+	var kb *telegram.InlineKeyboardMarkup
+	if len(list) == 0 {
+		text = role.empty
+	} else {
+		var rows [][]telegram.InlineKeyboardButton
+		for _, s := range list {
+			rows = append(rows, []telegram.InlineKeyboardButton{
+				{Text: role.label(s), CallbackData: role.prefix + ":view:" + strconv.FormatInt(s.ID, 10)},
+			})
+		}
+		kb = &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+	}
+
+	if msgID != 0 {
+		_ = c.TG.EditMessageText(c.ChatID, msgID, text, kb)
+		return
+	}
+	if kb == nil {
+		_ = c.TG.SendMessage(c.ChatID, text)
+		return
+	}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, text, kb)
+}
+
+// seriesHandler — обработчик кнопок <prefix>:... для роли
+func seriesHandler(role seriesRole) HandlerFunc {
+	return func(c *Ctx) {
+		parts := strings.Split(strings.TrimPrefix(c.Data, role.prefix+":"), ":")
+		if parts[0] == "list" {
+			sendSeriesList(c, role, c.MsgID)
+			return
+		}
+		if len(parts) < 2 {
+			return
+		}
+		id, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return
+		}
+
+		s, ok, err := database.GetSeries(c.DB, id)
+		if err != nil {
+			slog.Error("get series error", "series_id", id, "err", err)
+			_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+			return
+		}
+		if !ok || !role.owns(c, s) {
+			_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Серия не найдена", nil)
+			return
+		}
+
+		switch {
+		case parts[0] == "view" && len(parts) == 2:
+			editSeriesView(c, role, s)
+
+		case parts[0] == "skip" && len(parts) == 3:
+			appID, err := strconv.ParseInt(parts[2], 10, 64)
+			if err != nil {
+				return
+			}
+			skipSeriesOccurrence(c, role, s, appID)
+
+		case parts[0] == "cancel" && len(parts) == 2:
+			apps, err := database.GetSeriesAppointments(c.DB, s.ID, time.Now().Unix())
+			if err != nil {
+				slog.Error("get series appointments error", "series_id", s.ID, "err", err)
+				_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+				return
+			}
+			text := "Отменить все оставшиеся занятия серии (" + strconv.Itoa(len(apps)) + ")?"
+			if late := lateCount(apps, role.terms()); late > 0 {
+				text += "\n\n" + cancelPolicyText() + "\n⚠️ Поздняя отмена: " + strconv.Itoa(late) + " " + plural(late, "занятие", "занятия", "занятий")
+			}
+			kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+				{Text: "✅ Да", CallbackData: role.prefix + ":cancel_yes:" + parts[1]},
+				{Text: "❌ Нет", CallbackData: role.prefix + ":view:" + parts[1]},
+			}}}
+			_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, kb)
+
+		case parts[0] == "cancel_yes" && len(parts) == 2:
+			cancelSeries(c, role, s)
+		}
+	}
+}
+
+// editSeriesView показывает серию и её будущие занятия в том же сообщении
+func editSeriesView(c *Ctx, role seriesRole, s database.Series) {
+	apps, err := database.GetSeriesAppointments(c.DB, s.ID, time.Now().Unix())
+	if err != nil {
+		slog.Error("get series appointments error", "series_id", s.ID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	id := strconv.FormatInt(s.ID, 10)
+	back := []telegram.InlineKeyboardButton{{Text: "⟵ К списку", CallbackData: role.prefix + ":list"}}
+	if len(apps) == 0 {
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "В этой серии больше нет занятий", &telegram.InlineKeyboardMarkup{
+			InlineKeyboard: [][]telegram.InlineKeyboardButton{back},
+		})
+		return
+	}
+
+	text := "🔁 Повтор: " + seriesRuleLabel(s) + "\n" +
+		role.party(c, s) +
+		"До: " + time.Unix(s.UntilTS, 0).In(loc).Format("02.01.2006") + "\n" +
+		"Осталось занятий: " + strconv.Itoa(len(apps)) + "\n\n" +
+		"Нажмите на занятие, чтобы пропустить только его."
+	if role.terms().LateBeforeTS > 0 {
+		text += "\nПропуск позже чем за " + noticeLabel() + " до начала — поздняя отмена."
+	}
+
+	var rows [][]telegram.InlineKeyboardButton
+	for _, a := range apps {
+		rows = append(rows, []telegram.InlineKeyboardButton{{
+			Text:         "⏭ " + time.Unix(a.StartTS, 0).In(loc).Format("02.01.2006 15:04"),
+			CallbackData: role.prefix + ":skip:" + id + ":" + strconv.FormatInt(a.ID, 10),
+		}})
+	}
+	rows = append(rows,
+		[]telegram.InlineKeyboardButton{{Text: "❌ Отменить все оставшиеся", CallbackData: role.prefix + ":cancel:" + id}},
+		back,
+	)
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, text, &telegram.InlineKeyboardMarkup{InlineKeyboard: rows})
+}
+
+// skipSeriesOccurrence отменяет одно занятие серии, остальные остаются
+func skipSeriesOccurrence(c *Ctx, role seriesRole, s database.Series, appID int64) {
+	apps, err := database.GetSeriesAppointments(c.DB, s.ID, time.Now().Unix())
+	if err != nil {
+		slog.Error("get series appointments error", "series_id", s.ID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	var skipped *database.Appointment
+	for i := range apps {
+		if apps[i].ID == appID {
+			skipped = &apps[i]
+		}
+	}
+	if skipped == nil {
+		// уже отменено или прошло — просто обновляем список
+		editSeriesView(c, role, s)
+		return
+	}
+
+	canceled, err := database.CancelAppointmentTx(c.DB, *skipped, role.terms())
+	switch {
+	case err == database.ErrAppointmentChanged:
+		editSeriesView(c, role, s)
+		return
+	case err != nil:
+		slog.Error("skip series appointment error", "series_id", s.ID, "appointment_id", appID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка отмены записи")
+		return
+	}
+
+	when := time.Unix(skipped.StartTS, 0).In(time.FixedZone("Europe/Moscow", 3*3600)).Format("02.01.2006 15:04")
+	text := "✅ Занятие " + when + " пропущено, остальные остаются"
+	if canceled.Late {
+		text += "\n⚠️ Отмена поздняя"
+	}
+	_ = c.TG.SendMessage(c.ChatID, text)
+	if canceled.CanceledBy == database.CanceledByTeacher {
+		notifyCancelStudent(c.TG, c.DB, canceled)
+	} else {
+		notifyCancelTeacher(c.TG, c.DB, canceled)
+	}
+	editSeriesView(c, role, s)
+	offerFreedSlot(c.TG, c.DB, skipped.TeacherID, skipped.StartTS)
+}
+
+// cancelSeries отменяет все будущие занятия серии
+func cancelSeries(c *Ctx, role seriesRole, s database.Series) {
+	canceled, err := database.CancelSeriesTx(c.DB, s.ID, time.Now().Unix(), role.terms())
+	if err != nil {
+		slog.Error("cancel series error", "series_id", s.ID, "err", err)
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Ошибка отмены серии", nil)
+		return
+	}
+
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "✅ Серия отменена, отменено занятий: "+strconv.Itoa(len(canceled)), nil)
+	if len(canceled) > 0 {
+		role.notify(c, s, "❌ Отменена серия «"+seriesRuleLabel(s)+"», отменено занятий: "+strconv.Itoa(len(canceled)))
+	}
+
+	// поздние — отдельно, чтобы преподаватель мог простить каждую;
+	// освободившиеся дни — листу ожидания, каждый день один раз
+	offered := make(map[string]bool)
+	for _, lc := range canceled {
+		if lc.Late {
+			notifyCancelTeacher(c.TG, c.DB, lc)
+		}
+		day := time.Unix(lc.StartTS, 0).In(time.FixedZone("Europe/Moscow", 3*3600)).Format("2006-01-02")
+		if !offered[day] {
+			offered[day] = true
+			offerFreedSlot(c.TG, c.DB, lc.TeacherID, lc.StartTS)
+		}
+	}
+}
+
+// lateCount — сколько из занятий apps по правилам terms отменяются поздно
+func lateCount(apps []database.Appointment, terms database.CancelTerms) int {
+	n := 0
+	for _, a := range apps {
+		if a.StartTS < terms.LateBeforeTS {
+			n++
+		}
+	}
+	return n
+}
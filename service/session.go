@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bot/database"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Session — состояние диалога с одним чатом: шаг записи и промежуточный ввод
+type Session struct {
+	Booking       BookingState `json:"booking"`
+	StudentStatus string       `json:"student_status,omitempty"` // "wait_name" / "cancel_reason"
+	TeacherStatus string       `json:"teacher_status,omitempty"` // "login" / "password" / "wh_day" / "wh_exception" / "t_cancel_reason" / "t_book_name" / "bp_add"
+	TeacherLogin  string       `json:"teacher_login,omitempty"`
+	WorkingDay    int          `json:"working_day,omitempty"`   // какой день недели правим (time.Weekday)
+	CancelAppID   int64        `json:"cancel_app_id,omitempty"` // какую запись отменяем, пока вводится причина
+	CancelDate    string       `json:"cancel_date,omitempty"`   // день (YYYY-MM-DD), который показать преподавателю после отмены
+}
+
+// empty — в сессии ничего нет, хранить её незачем.
+// Сравнение требует, чтобы Session оставалась сравнимой: поле-срез или map
+// не скомпилируется, и тогда здесь нужно будет сравнивать поля явно.
+func (s *Session) empty() bool {
+	return *s == Session{}
+}
+
+// step — шаг диалога, которому достаётся свободный ввод.
+// Вход преподавателя и ввод имени важнее незаконченной записи.
+func (s *Session) step() string {
+	switch {
+	case s.TeacherStatus != "":
+		return s.TeacherStatus
+	case s.StudentStatus != "":
+		return s.StudentStatus
+	}
+	return s.Booking.Step
+}
+
+// SessionStore хранит сессии между обновлениями (и, в случае SQLite, между перезапусками).
+// Сессия, которую не трогали дольше TTL, считается брошенной и исчезает.
+type SessionStore interface {
+	// Load возвращает сессию чата (пустую, если её нет или она истекла)
+	Load(chatID int64) (*Session, error)
+
+	// Save сохраняет сессию и продлевает её TTL; пустая сессия удаляется
+	Save(chatID int64, s *Session) error
+
+	// DeleteExpired удаляет брошенные сессии
+	DeleteExpired() (int64, error)
+}
+
+// Сколько живёт брошенная сессия (меняется через Config)
+const defaultSessionTTL = 24 * time.Hour
+
+// sessions — хранилище, которым пользуется бот (задаётся в StartBot)
+var sessions SessionStore = NewMemorySessionStore(defaultSessionTTL)
+
+type sqliteSessionStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewSQLiteSessionStore — сессии в таблице sessions, переживают перезапуск бота
+func NewSQLiteSessionStore(db *sql.DB, ttl time.Duration) SessionStore {
+	return &sqliteSessionStore{db: db, ttl: ttl}
+}
+
+func (st *sqliteSessionStore) Load(chatID int64) (*Session, error) {
+	data, ok, err := database.GetSession(st.db, chatID, time.Now().Unix())
+	if err != nil || !ok {
+		return &Session{}, err
+	}
+
+	s := &Session{}
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		// формат поменялся — начинаем с чистого листа
+		slog.Error("decode session error", "chat_id", chatID, "err", err)
+		return &Session{}, nil
+	}
+	return s, nil
+}
+
+func (st *sqliteSessionStore) Save(chatID int64, s *Session) error {
+	if s.empty() {
+		return database.DeleteSession(st.db, chatID)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return database.SaveSession(st.db, chatID, string(data), now.Unix(), now.Add(st.ttl).Unix())
+}
+
+func (st *sqliteSessionStore) DeleteExpired() (int64, error) {
+	return database.DeleteExpiredSessions(st.db, time.Now().Unix())
+}
+
+type memorySession struct {
+	s       Session
+	expires time.Time
+}
+
+type memorySessionStore struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	data map[int64]memorySession
+}
+
+// NewMemorySessionStore — сессии в памяти процесса (по умолчанию до StartBot и в тестах)
+func NewMemorySessionStore(ttl time.Duration) SessionStore {
+	return &memorySessionStore{ttl: ttl, data: make(map[int64]memorySession)}
+}
+
+func (st *memorySessionStore) Load(chatID int64) (*Session, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	m, ok := st.data[chatID]
+	if !ok || !time.Now().Before(m.expires) {
+		return &Session{}, nil
+	}
+	// копия через JSON — как и в SQLite, изменения видны только после Save
+	return cloneSession(&m.s)
+}
+
+func (st *memorySessionStore) Save(chatID int64, s *Session) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if s.empty() {
+		delete(st.data, chatID)
+		return nil
+	}
+	c, err := cloneSession(s)
+	if err != nil {
+		return err
+	}
+	st.data[chatID] = memorySession{s: *c, expires: time.Now().Add(st.ttl)}
+	return nil
+}
+
+func (st *memorySessionStore) DeleteExpired() (int64, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	var n int64
+	for id, m := range st.data {
+		if !now.Before(m.expires) {
+			delete(st.data, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func cloneSession(s *Session) (*Session, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &Session{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// runSessionCleanup периодически удаляет брошенные сессии
+func runSessionCleanup(store SessionStore) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := store.DeleteExpired()
+		if err != nil {
+			slog.Error("delete expired sessions error", "err", err)
+			continue
+		}
+		if n > 0 {
+			slog.Info("expired sessions deleted", "count", n)
+		}
+	}
+}
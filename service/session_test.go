@@ -0,0 +1,103 @@
+package service
+
+import (
+	"bot/database"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sessionStores — оба хранилища с заданным TTL
+func sessionStores(t *testing.T, ttl time.Duration) map[string]SessionStore {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "app.db"))
+	db, err := database.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return map[string]SessionStore{
+		"memory": NewMemorySessionStore(ttl),
+		"sqlite": NewSQLiteSessionStore(db, ttl),
+	}
+}
+
+func TestSessionStoreRoundTrip(t *testing.T) {
+	for name, st := range sessionStores(t, time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			in := &Session{
+				Booking:       BookingState{Step: "pick_time", TeacherID: 3, Date: "2026-11-17", DurationMin: 60},
+				TeacherStatus: "wh_day",
+				WorkingDay:    2,
+			}
+			if err := st.Save(1, in); err != nil {
+				t.Fatal(err)
+			}
+
+			// изменения после Save в хранилище не попадают
+			in.Booking.Step = "confirm"
+
+			out, err := st.Load(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Booking.Step != "pick_time" || out.Booking.TeacherID != 3 || out.WorkingDay != 2 || out.TeacherStatus != "wh_day" {
+				t.Fatalf("loaded %+v", out)
+			}
+
+			other, err := st.Load(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !other.empty() {
+				t.Fatalf("unknown chat: %+v", other)
+			}
+		})
+	}
+}
+
+func TestSessionStoreEmptyDeletes(t *testing.T) {
+	for name, st := range sessionStores(t, time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			if err := st.Save(1, &Session{StudentStatus: "wait_name"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Save(1, &Session{}); err != nil {
+				t.Fatal(err)
+			}
+			s, err := st.Load(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.empty() {
+				t.Fatalf("session kept: %+v", s)
+			}
+		})
+	}
+}
+
+func TestSessionStoreTTL(t *testing.T) {
+	// отрицательный TTL — сессия истекает сразу после сохранения
+	for name, st := range sessionStores(t, -time.Minute) {
+		t.Run(name, func(t *testing.T) {
+			if err := st.Save(1, &Session{StudentStatus: "wait_name"}); err != nil {
+				t.Fatal(err)
+			}
+			s, err := st.Load(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.empty() {
+				t.Fatalf("expired session loaded: %+v", s)
+			}
+
+			n, err := st.DeleteExpired()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Fatalf("DeleteExpired = %d, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Варианты «за сколько напоминать» (в минутах), которые предлагаем ученику
+var reminderLeadOptions = []int{15, 60, 180, 1440}
+
+// leadLabel — человекочитаемое «за сколько»: 15 мин, 1 ч, 1 день
+func leadLabel(min int) string {
+	switch {
+	case min%1440 == 0:
+		days := min / 1440
+		if days == 1 {
+			return "1 день"
+		}
+		return strconv.Itoa(days) + " дн."
+	case min%60 == 0:
+		return strconv.Itoa(min/60) + " ч"
+	default:
+		return strconv.Itoa(min) + " мин"
+	}
+}
+
+func settingsText(s database.UserSettings) string {
+	if !s.RemindersEnabled {
+		return "⚙️ Настройки напоминаний\n\nНапоминания выключены."
+	}
+	text := "⚙️ Настройки напоминаний\n\nНапоминать за:"
+	for _, m := range s.Leads() {
+		text += "\n- " + leadLabel(m)
+	}
+	return text
+}
+
+func SettingsKeyboard(s database.UserSettings) *telegram.InlineKeyboardMarkup {
+	toggle := telegram.InlineKeyboardButton{Text: "🔕 Выключить напоминания", CallbackData: "set:toggle"}
+	if !s.RemindersEnabled {
+		toggle = telegram.InlineKeyboardButton{Text: "🔔 Включить напоминания", CallbackData: "set:toggle"}
+	}
+	rows := [][]telegram.InlineKeyboardButton{{toggle}}
+
+	if s.RemindersEnabled {
+		var row []telegram.InlineKeyboardButton
+		for _, m := range reminderLeadOptions {
+			mark := "▫️ "
+			if slices.Contains(s.Leads(), m) {
+				mark = "✅ "
+			}
+			row = append(row, telegram.InlineKeyboardButton{
+				Text:         mark + leadLabel(m),
+				CallbackData: "set:lead:" + strconv.Itoa(m),
+			})
+			// 2 колонки
+			if len(row) == 2 {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+func sendSettings(c *Ctx) {
+	s, err := database.GetUserSettings(c.DB, c.ChatID)
+	if err != nil {
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, settingsText(s), SettingsKeyboard(s))
+}
+
+// handleSettingsCallback обрабатывает set:toggle и set:lead:<мин>
+func handleSettingsCallback(c *Ctx) {
+	s, err := database.GetUserSettings(c.DB, c.ChatID)
+	if err != nil {
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+
+	switch {
+	case c.Data == "set:toggle":
+		s.RemindersEnabled = !s.RemindersEnabled
+
+	case strings.HasPrefix(c.Data, "set:lead:"):
+		m, err := strconv.Atoi(strings.TrimPrefix(c.Data, "set:lead:"))
+		if err != nil || !slices.Contains(reminderLeadOptions, m) {
+			return
+		}
+		leads := s.Leads()
+		if i := slices.Index(leads, m); i >= 0 {
+			if len(leads) == 1 {
+				_ = c.TG.SendMessage(c.ChatID, "Должно остаться хотя бы одно время напоминания. Чтобы не получать напоминания, выключите их.")
+				return
+			}
+			leads = slices.Delete(leads, i, i+1)
+		} else {
+			leads = append(leads, m)
+		}
+		s.SetLeads(leads)
+
+	default:
+		return
+	}
+
+	if err := database.SaveUserSettings(c.DB, c.ChatID, s); err != nil {
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+		return
+	}
+	// обновляем то же меню, а не присылаем новое
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, settingsText(s), SettingsKeyboard(s))
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bot/database"
+	"database/sql"
+	"time"
+)
+
+// daySlots — варианты начала занятия у преподавателя teacherID длительностью durationMin
+// на дату (YYYY-MM-DD) с шагом 30 минут.
+// Прошедшее, нерабочее и закрытое (отпуск, перерыв) время в список не попадает,
+// пересечения с его записями и с бронью листа ожидания за кем-то кроме chatID помечены Busy.
+// Запись exceptID (ту, что переносят) занятой не считается; 0 — учитываются все.
+func daySlots(db *sql.DB, teacherID int64, chatID int64, date string, durationMin int, exceptID int64) ([]TimeSlot, error) {
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	wh, err := database.GetWorkingHours(db, teacherID, day)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := database.GetBlockedPeriods(db, teacherID, date)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := database.GetAppointmentsByDay(db, teacherID, day.Unix(), day.Add(24*time.Hour).Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	if exceptID != 0 {
+		var rest []database.Appointment
+		for _, a := range apps {
+			if a.ID != exceptID {
+				rest = append(rest, a)
+			}
+		}
+		apps = rest
+	}
+
+	held, err := heldOffers(db, teacherID, chatID, day.Unix(), day.Add(24*time.Hour).Unix())
+	if err != nil {
+		return nil, err
+	}
+	apps = append(apps, held...)
+	return computeSlots(day, wh, blocked, apps, durationMin, time.Now().Unix()), nil
+}
+
+// heldOffers — время, которое держится за другими учениками (не chatID) из листа ожидания,
+// в виде записей: для выбора времени оно занято так же, как обычная запись
+func heldOffers(db *sql.DB, teacherID int64, chatID int64, fromTS int64, toTS int64) ([]database.Appointment, error) {
+	offers, err := database.GetHeldWaitlistOffers(db, teacherID, fromTS, toTS, chatID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]database.Appointment, 0, len(offers))
+	for _, e := range offers {
+		res = append(res, database.Appointment{
+			TeacherID:     e.TeacherID,
+			StudentChatID: e.StudentChatID,
+			StudentName:   e.StudentName,
+			StartTS:       e.OfferStartTS,
+			EndTS:         e.OfferStartTS + int64(e.DurationMin)*60,
+			DurationMin:   e.DurationMin,
+		})
+	}
+	return res, nil
+}
+
+// computeSlots — то же, что daySlots, по уже прочитанным рабочему времени, недоступности и записям дня
+func computeSlots(day time.Time, wh database.WorkingHours, blocked database.BlockedPeriods, apps []database.Appointment, durationMin int, now int64) []TimeSlot {
+	var slots []TimeSlot
+	for m := 0; m+durationMin <= 24*60; m += 30 {
+		if !wh.Contains(m, durationMin) || blocked.Blocks(day, m, durationMin) {
+			continue
+		}
+		start := day.Add(time.Duration(m) * time.Minute).Unix()
+		if start <= now {
+			continue
+		}
+		end := start + int64(durationMin)*60
+
+		busy := false
+		for _, a := range apps {
+			if a.StartTS < end && a.EndTS > start {
+				busy = true
+				break
+			}
+		}
+		slots = append(slots, TimeSlot{Min: m, Busy: busy})
+	}
+	return slots
+}
+
+// slotProblem — почему на это время (минуты от полуночи) записаться нельзя; "" — можно
+func slotProblem(slots []TimeSlot, min int) string {
+	for _, s := range slots {
+		if s.Min == min {
+			if s.Busy {
+				return "Это время уже занято. Выберите другое."
+			}
+			return ""
+		}
+	}
+	return "На это время записаться нельзя: оно прошло или преподаватель не работает."
+}
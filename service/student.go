@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"log/slog"
+	"time"
+)
+
+// handleStart — /start и «Назад»: сбрасываем диалог и предлагаем выбрать роль
+func handleStart(c *Ctx) {
+	*c.Sess = Session{}
+
+	message := "Доброго времени суток!\nПожалуйста, выберите вашу роль для продолжения работы с ботом."
+	if err := c.TG.SendMessageKeyboard(c.ChatID, message, Rolekeyboard()); err != nil {
+		slog.Error("send message error", "err", err)
+	}
+}
+
+func handleUnknown(c *Ctx) {
+	_ = c.TG.SendMessage(c.ChatID, "Выберите роль или нажмите /start")
+}
+
+// «Ученик»: знакомых сразу пускаем в меню, новых просим представиться
+func handleStudentRole(c *Ctx) {
+	name, ok, err := database.GetStudentName(c.DB, c.ChatID)
+	if err != nil {
+		slog.Error("DB read error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if ok {
+		_ = c.TG.SendMessageKeyboard(c.ChatID, "Вы записаны как: "+name, Studkeyboard())
+		return
+	}
+
+	c.Sess.StudentStatus = "wait_name"
+	_ = c.TG.SendMessage(c.ChatID, "Введите Ваши инициалы...\n(Например: Иванов И.И./ Иванов И. , если нет отчества)")
+}
+
+// шаг wait_name
+func handleStudentName(c *Ctx) {
+	name, ok := Namevalidation(c.Text)
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Неверный формат. Пример: Иванов И.И. или Иванов И.")
+		return
+	}
+
+	if err := database.UpsertStudentName(c.DB, c.ChatID, name); err != nil {
+		slog.Error("save student name error", "chat_id", c.ChatID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+		return
+	}
+
+	c.Sess.StudentStatus = ""
+	_ = c.TG.SendMessageKeyboard(c.ChatID, "Готово! Вы записаны как: "+name, Studkeyboard())
+}
+
+// «Мои записи» — только список, кнопки ничего не делают
+func handleMyAppointments(c *Ctx) {
+	sendFutureAppointments(c, "Ваши будущие записи:", func(a database.Appointment, when string) telegram.InlineKeyboardButton {
+		return telegram.InlineKeyboardButton{Text: when, CallbackData: "noop"}
+	})
+}
+
+func sendFutureAppointments(c *Ctx, title string, button func(a database.Appointment, when string) telegram.InlineKeyboardButton) {
+	apps, err := database.GetFutureAppointments(c.DB, c.ChatID)
+	if err != nil {
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if len(apps) == 0 {
+		_ = c.TG.SendMessage(c.ChatID, "У вас нет будущих записей")
+		return
+	}
+
+	// преподавателей несколько — подписываем, к кому запись
+	teachers, err := database.GetTeachers(c.DB)
+	if err != nil {
+		slog.Error("get teachers error", "err", err)
+	}
+	names := make(map[int64]string, len(teachers))
+	for _, t := range teachers {
+		names[t.ID] = t.DisplayName()
+	}
+
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	var rows [][]telegram.InlineKeyboardButton
+	for _, a := range apps {
+		when := time.Unix(a.StartTS, 0).In(loc).Format("02.01.2006 15:04")
+		if name := names[a.TeacherID]; len(teachers) > 1 && name != "" {
+			when += " — " + name
+		}
+		rows = append(rows, []telegram.InlineKeyboardButton{button(a, when)})
+	}
+
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, title, kb)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bot/database"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// «Записать ученика»: преподаватель записывает ученика сам (например, договорились по телефону) —
+// выбор ученика → день → длительность → время → повторы → подтверждение
+func handleTeacherBook(c *Ctx) {
+	students, err := database.GetStudents(c.DB, currentTeacherID(c.ChatID))
+	if err != nil {
+		slog.Error("get students error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+
+	st := &c.Sess.Booking
+	if st.MsgID != 0 {
+		_ = c.TG.EditMessageReplyMarkup(c.ChatID, st.MsgID, nil)
+	}
+	*st = BookingState{}
+
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, studentPickText(students), StudentPickKeyboard(students, 0))
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+func studentPickText(students []database.Student) string {
+	if len(students) == 0 {
+		return "Учеников пока нет. Заведите ученика без Telegram:"
+	}
+	return "Кого записать? (📵 — ученик без Telegram)"
+}
+
+// t_book_page:<page>
+func handleTeacherBookPage(c *Ctx) {
+	page, err := strconv.Atoi(strings.TrimPrefix(c.Data, "t_book_page:"))
+	if err != nil {
+		return
+	}
+	students, err := database.GetStudents(c.DB, currentTeacherID(c.ChatID))
+	if err != nil {
+		slog.Error("get students error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	_ = c.TG.EditMessageReplyMarkup(c.ChatID, c.MsgID, StudentPickKeyboard(students, page))
+}
+
+// t_book_st:<chat_id>
+func handleTeacherBookStudent(c *Ctx) {
+	chatID, err := strconv.ParseInt(strings.TrimPrefix(c.Data, "t_book_st:"), 10, 64)
+	if err != nil {
+		return
+	}
+	name, ok, err := database.GetStudentName(c.DB, chatID)
+	if err != nil {
+		slog.Error("get student name error", "chat_id", chatID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Ученик не найден. Нажмите «Записать ученика» ещё раз.")
+		return
+	}
+
+	st := &c.Sess.Booking
+	*st = BookingState{Step: "pick_date", TeacherID: currentTeacherID(c.ChatID), ForChatID: chatID, ForName: name, MsgID: c.MsgID}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Ученик: "+name+"\nВыберите дату:", tutorCalendar(c, st.TeacherID))
+}
+
+// t_book_new — завести ученика без Telegram
+func handleTeacherBookNew(c *Ctx) {
+	_ = c.TG.EditMessageReplyMarkup(c.ChatID, c.MsgID, nil)
+	c.Sess.Booking = BookingState{}
+	c.Sess.TeacherStatus = "t_book_name"
+	_ = c.TG.SendMessage(c.ChatID, "Введите фамилию и инициалы ученика (например: Иванов И.И.)\nили «отмена».")
+}
+
+// шаг t_book_name
+func handleTeacherBookName(c *Ctx) {
+	name, ok := Namevalidation(c.Text)
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Неверный формат. Пример: Иванов И.И. или Иванов И.")
+		return
+	}
+	c.Sess.TeacherStatus = ""
+
+	chatID, err := database.CreatePlaceholderStudent(c.DB, currentTeacherID(c.ChatID), name)
+	if err != nil {
+		slog.Error("create placeholder student error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+		return
+	}
+	slog.Info("placeholder student created", "chat_id", chatID, "teacher_id", currentTeacherID(c.ChatID))
+
+	st := &c.Sess.Booking
+	*st = BookingState{Step: "pick_date", TeacherID: currentTeacherID(c.ChatID), ForChatID: chatID, ForName: name}
+	mid, err := c.TG.SendMessageInlineKeyboardReturnID(c.ChatID, "Ученик: "+name+" 📵\nВыберите дату:", tutorCalendar(c, st.TeacherID))
+	if err == nil {
+		st.MsgID = mid
+	}
+}
+
+// bookingStudent — за кого запись: сам ученик или ученик, которого записывает преподаватель
+func bookingStudent(c *Ctx, st *BookingState) (int64, string, bool) {
+	if st.ForChatID == 0 {
+		name, ok, err := database.GetStudentName(c.DB, c.ChatID)
+		if err != nil || !ok {
+			_ = c.TG.SendMessage(c.ChatID, "Не найдено имя ученика. Нажмите /start и выберите Ученик.")
+			return 0, "", false
+		}
+		return c.ChatID, name, true
+	}
+
+	// записывать других может только сам преподаватель и только к себе
+	if st.TeacherID != currentTeacherID(c.ChatID) {
+		_ = c.TG.SendMessage(c.ChatID, "Записать ученика можно только к себе. Войдите как преподаватель и нажмите «Записать ученика».")
+		return 0, "", false
+	}
+	name, ok, err := database.GetStudentName(c.DB, st.ForChatID)
+	if err != nil {
+		slog.Error("get student name error", "chat_id", st.ForChatID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return 0, "", false
+	}
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Ученик не найден. Нажмите «Записать ученика» ещё раз.")
+		return 0, "", false
+	}
+	return st.ForChatID, name, true
+}
+
+// bookingChatID — для кого подбирается время: ученик, которого записывает преподаватель,
+// или сам пишущий. Без обращения к базе — только чтобы не прятать от ученика его же бронь.
+func bookingChatID(c *Ctx, st *BookingState) int64 {
+	if st.ForChatID != 0 {
+		return st.ForChatID
+	}
+	return c.ChatID
+}
+
+// notifyBookedStudent сообщает ученику, что преподаватель teacherID его записал
+// (ученику без Telegram — некуда, notifyStudent это пропустит)
+func notifyBookedStudent(c *Ctx, chatID int64, teacherID int64, text string) {
+	if t, ok, err := database.GetTeacher(c.DB, teacherID); err == nil && ok {
+		text += "\nПреподаватель: " + t.DisplayName()
+	}
+	notifyStudent(c.TG, c.DB, chatID, text)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	calendar "bot/calendarwidget"
+	"bot/database"
+	"bot/telegram"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// «Преподаватель»: если уже вошёл на этом устройстве — сразу меню
+func handleTeacherRole(c *Ctx) {
+	if isTeacher(c.DB, c.ChatID) {
+		_ = c.TG.SendMessageKeyboard(c.ChatID, "Меню преподавателя:", Teachkeyboard())
+		return
+	}
+	c.Sess.TeacherStatus = "login"
+	c.Sess.TeacherLogin = ""
+	_ = c.TG.SendMessage(c.ChatID, "Введите логин:")
+}
+
+// шаг login
+func handleTeacherLogin(c *Ctx) {
+	c.Sess.TeacherLogin = c.Text
+	c.Sess.TeacherStatus = "password"
+	_ = c.TG.SendMessage(c.ChatID, "Введите пароль:")
+}
+
+// шаг password
+func handleTeacherPassword(c *Ctx) {
+	login := c.Sess.TeacherLogin
+	c.Sess.TeacherStatus = ""
+	c.Sess.TeacherLogin = ""
+
+	t, ok, err := database.GetTeacherByLogin(c.DB, login)
+	if err != nil {
+		slog.Error("DB read error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok || !CheckPassword(t.PasswordHash, c.Text) {
+		_ = c.TG.SendMessage(c.ChatID, "Неверный логин или пароль!")
+		return
+	}
+
+	// ✅ сессия сохраняется в базе — переживает перезапуск бота
+	if err := loginTeacher(c.DB, c.ChatID, t.ID); err != nil {
+		slog.Error("save teacher session error", "chat_id", c.ChatID, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+		return
+	}
+	slog.Info("teacher logged in", "chat_id", c.ChatID, "teachers_count", teacherChats.count())
+	_ = c.TG.SendMessage(c.ChatID, "Авторизация прошла успешно!")
+	_ = c.TG.SendMessageKeyboard(c.ChatID, "Меню преподавателя:", Teachkeyboard())
+}
+
+// «Выйти» / /logout
+func handleTeacherLogout(c *Ctx) {
+	if !isTeacher(c.DB, c.ChatID) {
+		_ = c.TG.SendMessageKeyboard(c.ChatID, "Вы не вошли как преподаватель.", Rolekeyboard())
+		return
+	}
+	logoutTeacher(c.DB, c.ChatID)
+	slog.Info("teacher logged out", "chat_id", c.ChatID)
+	_ = c.TG.SendMessageKeyboard(c.ChatID, "Вы вышли из аккаунта преподавателя.", Rolekeyboard())
+}
+
+// «Записи по дням» / /day: календарь, по нажатию на день — записи этого дня
+func handleTeacherDays(c *Ctx) {
+	// важно: сбросить старую "ученическую" запись, если была
+	c.Sess.Booking = BookingState{}
+
+	now := time.Now().In(time.FixedZone("Europe/Moscow", 3*3600))
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: bookingCalendar(c, calTeacherDays, currentTeacherID(c.ChatID), now.Year(), now.Month()).GetKeyboard()}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, "Выберите дату:", kb)
+}
+
+// handleTeacherCalendar — нажатие в календаре «Записи по дням»
+func handleTeacherCalendar(c *Ctx, cb calendar.Callback) {
+	if cb.Action != calendar.ActionDay {
+		editCalendar(c, cb, currentTeacherID(c.ChatID))
+		return
+	}
+	sendTeacherDay(c, cb.Date().Format("2006-01-02"), "записей нет.")
+}
+
+// sendTeacherDay присылает записи вошедшего преподавателя на день (YYYY-MM-DD) с кнопками отмены и переноса.
+// empty — конец фразы «На <дата> ...», если записей нет.
+func sendTeacherDay(c *Ctx, date string, empty string) {
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return
+	}
+	dayStart := day.Unix()
+	dayEnd := day.Add(24 * time.Hour).Unix()
+
+	apps, err := database.GetAppointmentsByDay(c.DB, currentTeacherID(c.ChatID), dayStart, dayEnd)
+	if err != nil {
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if len(apps) == 0 {
+		_ = c.TG.SendMessage(c.ChatID, "На "+day.Format("02.01.2006")+" "+empty)
+		return
+	}
+
+	var rows [][]telegram.InlineKeyboardButton
+	for _, a := range apps {
+		tm := time.Unix(a.StartTS, 0).In(loc).Format("15:04")
+		btnText := "❌ " + tm + " — " + a.StudentName + " (" + strconv.Itoa(a.DurationMin) + " мин)"
+		id := strconv.FormatInt(a.ID, 10)
+		rows = append(rows, []telegram.InlineKeyboardButton{
+			{Text: btnText, CallbackData: "t_cancel_app:" + id + ":" + date},
+			{Text: "↔️", CallbackData: "t_move_app:" + id},
+		})
+	}
+
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, "Записи на "+day.Format("02.01.2006")+" (❌ — отменить, ↔️ — перенести):", kb)
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Сколько живёт вход преподавателя без активности (меняется через Config)
+var teacherSessionTTL = 30 * 24 * time.Hour
+
+type teacherSession struct {
+	TeacherID int64
+	ExpiresTS int64
+}
+
+// teacherRegistry — чаты, в которых сейчас вошёл преподаватель (копия таблицы teacher_sessions).
+// Обновления обрабатываются в нескольких воркерах, поэтому доступ только через методы.
+type teacherRegistry struct {
+	mu    sync.RWMutex
+	chats map[int64]teacherSession
+}
+
+var teacherChats = &teacherRegistry{chats: make(map[int64]teacherSession)}
+
+func (r *teacherRegistry) get(chatID int64) (teacherSession, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.chats[chatID]
+	return s, ok
+}
+
+func (r *teacherRegistry) set(chatID int64, s teacherSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chats[chatID] = s
+}
+
+func (r *teacherRegistry) remove(chatID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.chats, chatID)
+}
+
+// snapshot — копия для рассылки, чтобы не держать блокировку во время отправки
+func (r *teacherRegistry) snapshot() map[int64]teacherSession {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m := make(map[int64]teacherSession, len(r.chats))
+	for id, s := range r.chats {
+		m[id] = s
+	}
+	return m
+}
+
+func (r *teacherRegistry) count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.chats)
+}
+
+// loadTeacherSessions поднимает сессии из базы при старте,
+// чтобы уведомления о новых записях приходили сразу после перезапуска
+func loadTeacherSessions(db *sql.DB) error {
+	sessions, err := database.GetTeacherSessions(db, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		teacherChats.set(s.ChatID, teacherSession{TeacherID: s.TeacherID, ExpiresTS: s.ExpiresTS})
+	}
+	slog.Info("teacher sessions loaded", "count", len(sessions))
+	return nil
+}
+
+func loginTeacher(db *sql.DB, chatID int64, teacherID int64) error {
+	expires := time.Now().Add(teacherSessionTTL).Unix()
+	if err := database.CreateTeacherSession(db, teacherID, chatID, expires); err != nil {
+		return err
+	}
+	teacherChats.set(chatID, teacherSession{TeacherID: teacherID, ExpiresTS: expires})
+	return nil
+}
+
+func logoutTeacher(db *sql.DB, chatID int64) {
+	teacherChats.remove(chatID)
+	if err := database.DeleteTeacherSession(db, chatID); err != nil {
+		slog.Error("delete teacher session error", "chat_id", chatID, "err", err)
+	}
+}
+
+// isTeacher — вошёл ли преподаватель в этом чате. Истёкшую сессию закрывает,
+// живую продлевает (не чаще раза в сутки, чтобы не писать в базу на каждое нажатие).
+func isTeacher(db *sql.DB, chatID int64) bool {
+	s, ok := teacherChats.get(chatID)
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	if s.ExpiresTS <= now.Unix() {
+		logoutTeacher(db, chatID)
+		return false
+	}
+
+	expires := now.Add(teacherSessionTTL).Unix()
+	if expires-s.ExpiresTS >= int64((24 * time.Hour).Seconds()) {
+		if err := database.ExtendTeacherSession(db, chatID, expires); err != nil {
+			slog.Error("extend teacher session error", "chat_id", chatID, "err", err)
+		} else {
+			s.ExpiresTS = expires
+			teacherChats.set(chatID, s)
+		}
+	}
+	return true
+}
+
+// currentTeacherID — какой преподаватель вошёл в этом чате (0 — никакой)
+func currentTeacherID(chatID int64) int64 {
+	s, _ := teacherChats.get(chatID)
+	return s.TeacherID
+}
+
+// notifyTeacher рассылает сообщение на все устройства, где вошёл преподаватель teacherID.
+// Истёкшие сессии и тех, кто заблокировал бота, убираем из рассылки.
+func notifyTeacher(tg *telegram.Client, db *sql.DB, teacherID int64, text string) {
+	notifyTeacherKeyboard(tg, db, teacherID, text, nil)
+}
+
+// notifyTeacherKeyboard — то же с кнопками под сообщением (nil — без кнопок)
+func notifyTeacherKeyboard(tg *telegram.Client, db *sql.DB, teacherID int64, text string, kb *telegram.InlineKeyboardMarkup) {
+	now := time.Now().Unix()
+	chats := teacherChats.snapshot()
+	sent := 0
+	for tid, s := range chats {
+		if s.TeacherID != teacherID {
+			continue
+		}
+		if s.ExpiresTS <= now {
+			logoutTeacher(db, tid)
+			continue
+		}
+		var err error
+		if kb == nil {
+			err = tg.SendMessage(tid, text)
+		} else {
+			err = tg.SendMessageInlineKeyboard(tid, text, kb)
+		}
+		if telegram.IsBlockedByUser(err) {
+			logoutTeacher(db, tid)
+			continue
+		}
+		if err != nil {
+			slog.Error("notify teacher send failed", "teacher_chat_id", tid, "err", err)
+			continue
+		}
+		sent++
+	}
+	slog.Info("notify teacher", "teacher_id", teacherID, "sent", sent)
+}
@@ -6,53 +6,93 @@ import (
 	"strconv"
 )
 
-// page: 0..3
-// 0 = 00:00-05:30
-// 1 = 06:00-11:30
-// 2 = 12:00-17:30
-// 3 = 18:00-23:30
-func TimeKeyboard(dateYYYYMMDD string, page int) *telegram.InlineKeyboardMarkup {
-	if page < 0 {
-		page = 0
-	}
-	if page > 3 {
-		page = 3
+// TimeSlot — время начала занятия (минуты от полуночи).
+// Busy — пересекается с чужой записью: кнопка видна, но не нажимается.
+type TimeSlot struct {
+	Min  int
+	Busy bool
+}
+
+// Страница — 6 часов: 0 = 00:00-05:30, 1 = 06:00-11:30, 2 = 12:00-17:30, 3 = 18:00-23:30
+const timePageMin = 6 * 60
+
+// timePages — страницы, на которых есть хоть один слот (по возрастанию)
+func timePages(slots []TimeSlot) []int {
+	var pages []int
+	for _, s := range slots {
+		p := s.Min / timePageMin
+		if len(pages) == 0 || pages[len(pages)-1] != p {
+			pages = append(pages, p)
+		}
 	}
+	return pages
+}
 
-	startHour := page * 6 // 0, 6, 12, 18
+// TimeKeyboard — слоты одной страницы. Пустые страницы пропускаются:
+// если на page ничего нет, показывается ближайшая следующая (или последняя).
+// slots должны идти по возрастанию.
+func TimeKeyboard(dateYYYYMMDD string, slots []TimeSlot, page int) *telegram.InlineKeyboardMarkup {
 	var rows [][]telegram.InlineKeyboardButton
 
-	// 12 строк: каждый час -> две кнопки (00 и 30)
-	for h := startHour; h < startHour+6; h++ {
-		t1 := fmt.Sprintf("%02d:00", h)
-		t2 := fmt.Sprintf("%02d:30", h)
+	pages := timePages(slots)
+	if len(pages) > 0 {
+		idx := len(pages) - 1
+		for i, p := range pages {
+			if p >= page {
+				idx = i
+				break
+			}
+		}
+		page = pages[idx]
 
-		rows = append(rows, []telegram.InlineKeyboardButton{
-			{Text: t1, CallbackData: "time_pick:" + dateYYYYMMDD + ":" + t1},
-			{Text: t2, CallbackData: "time_pick:" + dateYYYYMMDD + ":" + t2},
-		})
-	}
+		// по две кнопки в строке
+		var row []telegram.InlineKeyboardButton
+		for _, s := range slots {
+			if s.Min/timePageMin != page {
+				continue
+			}
+			t := clockLabel(s.Min)
+			btn := telegram.InlineKeyboardButton{Text: t, CallbackData: "time_pick:" + dateYYYYMMDD + ":" + t}
+			if s.Busy {
+				btn = telegram.InlineKeyboardButton{Text: "✖ " + t, CallbackData: "noop"}
+			}
+			row = append(row, btn)
+			if len(row) == 2 {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
 
-	// Навигация (⟵ page/4 ⟶)
-	nav := []telegram.InlineKeyboardButton{}
-	if page > 0 {
-		nav = append(nav, telegram.InlineKeyboardButton{
-			Text: "⟵", CallbackData: "time_page:" + dateYYYYMMDD + ":" + strconv.Itoa(page-1),
-		})
-	}
-	nav = append(nav, telegram.InlineKeyboardButton{
-		Text: fmt.Sprintf("%d/4", page+1), CallbackData: "noop",
-	})
-	if page < 3 {
-		nav = append(nav, telegram.InlineKeyboardButton{
-			Text: "⟶", CallbackData: "time_page:" + dateYYYYMMDD + ":" + strconv.Itoa(page+1),
+		// Навигация (⟵ k/n ⟶) — только по непустым страницам
+		if len(pages) > 1 {
+			nav := []telegram.InlineKeyboardButton{}
+			if idx > 0 {
+				nav = append(nav, telegram.InlineKeyboardButton{
+					Text: "⟵", CallbackData: "time_page:" + dateYYYYMMDD + ":" + strconv.Itoa(pages[idx-1]),
+				})
+			}
+			nav = append(nav, telegram.InlineKeyboardButton{
+				Text: fmt.Sprintf("%d/%d", idx+1, len(pages)), CallbackData: "noop",
+			})
+			if idx < len(pages)-1 {
+				nav = append(nav, telegram.InlineKeyboardButton{
+					Text: "⟶", CallbackData: "time_page:" + dateYYYYMMDD + ":" + strconv.Itoa(pages[idx+1]),
+				})
+			}
+			rows = append(rows, nav)
+		}
+
+		// Ручной ввод
+		rows = append(rows, []telegram.InlineKeyboardButton{
+			{Text: "⌨️ Ввести вручную", CallbackData: "time_manual:" + dateYYYYMMDD},
 		})
 	}
-	rows = append(rows, nav)
 
-	// Ручной ввод
 	rows = append(rows, []telegram.InlineKeyboardButton{
-		{Text: "⌨️ Ввести вручную", CallbackData: "time_manual:" + dateYYYYMMDD},
+		{Text: "⟵ Другой день", CallbackData: "time_cal"},
 	})
 
 	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"bot/telegram"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// runPolling получает обновления через getUpdates и складывает их в updates
+func runPolling(tg *telegram.Client, updates chan<- telegram.Update) {
+	// getUpdates не работает, пока установлен webhook (409 Conflict)
+	if err := tg.DeleteWebhook(false); err != nil {
+		slog.Error("deleteWebhook error", "err", err)
+	}
+
+	var lastUpdate int64
+	for {
+		var offset int64
+		if lastUpdate > 0 {
+			offset = lastUpdate + 1
+		}
+
+		batch, err := tg.GetUpdates(offset)
+		if err != nil {
+			slog.Error("getUpdates error", "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, update := range batch {
+			lastUpdate = update.UpdateID
+			updates <- update
+		}
+	}
+}
+
+// runWebhook регистрирует webhook и поднимает HTTP-сервер, который складывает обновления в updates.
+// Возвращает ошибку, только если сервер не смог запуститься или упал.
+func runWebhook(tg *telegram.Client, cfg WebhookConfig, updates chan<- telegram.Update) error {
+	err := tg.SetWebhook(telegram.SetWebhookParams{
+		URL:             cfg.URL,
+		SecretToken:     cfg.SecretToken,
+		CertificateFile: cfg.CertFile,
+	})
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.handlerPath(), telegram.WebhookHandler(cfg.SecretToken, updates))
+
+	srv := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	slog.Info("webhook server started", "addr", cfg.ListenAddr, "path", cfg.handlerPath())
+	if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+		err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Лист ожидания. Ученик встаёт в очередь на занятое время (или на любое время дня);
+// когда у преподавателя в этот день что-то отменяют или переносят, освободившееся время
+// по очереди предлагается ожидающим кнопкой «Забронировать», которая действует waitlistOfferTTL.
+// Кнопки: wl_join:<teacher_id>:<YYYYMMDD>:<HHMM|any>:<мин>, wl_book:<id>, wl_leave:<id>
+
+// Сколько держится предложение (меняется через Config)
+var waitlistOfferTTL = 30 * time.Minute
+
+// как часто проверяем просроченные предложения
+const waitlistPollInterval = 30 * time.Second
+
+// waitlistMu — предложения раздаются по одному, иначе два освобождения в один день
+// из разных воркеров предложили бы одно время двоим
+var waitlistMu sync.Mutex
+
+// WaitlistKeyboard — встать в очередь на время min (минуты от полуночи) или на весь день date
+func WaitlistKeyboard(teacherID int64, date string, min int, durationMin int) *telegram.InlineKeyboardMarkup {
+	prefix := "wl_join:" + strconv.FormatInt(teacherID, 10) + ":" + strings.ReplaceAll(date, "-", "") + ":"
+	suffix := ":" + strconv.Itoa(durationMin)
+
+	var rows [][]telegram.InlineKeyboardButton
+	if min >= 0 {
+		rows = append(rows, []telegram.InlineKeyboardButton{
+			{Text: "🔔 Ждать, когда освободится " + clockLabel(min), CallbackData: prefix + strings.ReplaceAll(clockLabel(min), ":", "") + suffix},
+		})
+	}
+	rows = append(rows, []telegram.InlineKeyboardButton{
+		{Text: "🔔 Ждать любое время в этот день", CallbackData: prefix + "any" + suffix},
+	})
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// waitlistWhen: "17.11.2026 17:30" или "17.11.2026, любое время"
+func waitlistWhen(e database.WaitlistEntry) string {
+	day := e.Date
+	if d, err := time.Parse("2006-01-02", e.Date); err == nil {
+		day = d.Format("02.01.2006")
+	}
+	if e.StartMin == database.WaitAnyTime {
+		return day + ", любое время"
+	}
+	return day + " " + clockLabel(e.StartMin)
+}
+
+// wl_join:<teacher_id>:<YYYYMMDD>:<HHMM|any>:<мин>
+func handleWaitlistJoin(c *Ctx) {
+	parts := strings.Split(c.Data, ":")
+	if len(parts) != 5 {
+		return
+	}
+	teacherID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return
+	}
+	day, err := time.Parse("20060102", parts[2])
+	if err != nil {
+		return
+	}
+	startMin := database.WaitAnyTime
+	if parts[3] != "any" {
+		hhmm, err := strconv.Atoi(parts[3])
+		if err != nil || len(parts[3]) != 4 {
+			return
+		}
+		startMin = hhmm/100*60 + hhmm%100
+	}
+	dur, err := strconv.Atoi(parts[4])
+	if err != nil || (dur != 60 && dur != 90) {
+		return
+	}
+
+	name, ok, err := database.GetStudentName(c.DB, c.ChatID)
+	if err != nil || !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Не найдено имя ученика. Нажмите /start и выберите Ученик.")
+		return
+	}
+
+	e := database.WaitlistEntry{
+		TeacherID:     teacherID,
+		StudentChatID: c.ChatID,
+		StudentName:   name,
+		Date:          day.Format("2006-01-02"),
+		StartMin:      startMin,
+		DurationMin:   dur,
+	}
+	id, err := database.JoinWaitlist(c.DB, e)
+	if err != nil {
+		slog.Error("join waitlist error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка записи в базу данных")
+		return
+	}
+	// ученик мог уже стоять в листе на это время — показываем то, что сохранилось
+	e, ok, err = database.GetWaitlistEntry(c.DB, id)
+	if err != nil {
+		slog.Error("get waitlist entry error", "id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok {
+		return // ученик уже вышел из листа
+	}
+
+	kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+		{Text: "Выйти из листа ожидания", CallbackData: "wl_leave:" + strconv.FormatInt(id, 10)},
+	}}}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "🔔 Вы в листе ожидания: "+waitlistWhen(e)+" ("+strconv.Itoa(e.DurationMin)+" мин).\n"+
+		"Когда время освободится, бот пришлёт предложение — бронь держится "+strconv.Itoa(int(waitlistOfferTTL.Minutes()))+" мин.", kb)
+
+	// время могло освободиться, пока ученик читал сообщение
+	offerWaitlist(c.TG, c.DB, teacherID, e.Date)
+}
+
+// wl_leave:<id> — выйти из листа ожидания (или отказаться от предложения)
+func handleWaitlistLeave(c *Ctx) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(c.Data, "wl_leave:"), 10, 64)
+	if err != nil {
+		return
+	}
+	e, ok, err := database.GetWaitlistEntry(c.DB, id)
+	if err != nil {
+		slog.Error("get waitlist entry error", "id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok || e.StudentChatID != c.ChatID {
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Вы уже не в листе ожидания", nil)
+		return
+	}
+	if err := database.LeaveWaitlist(c.DB, id, c.ChatID); err != nil {
+		slog.Error("leave waitlist error", "id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка записи в базу данных")
+		return
+	}
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Вы вышли из листа ожидания: "+waitlistWhen(e), nil)
+
+	// отказался от предложенного времени — предлагаем следующему
+	if e.OfferExpiresTS > time.Now().Unix() {
+		offerWaitlist(c.TG, c.DB, e.TeacherID, e.Date)
+	}
+}
+
+// wl_book:<id> — «Забронировать» предложенное время
+func handleWaitlistBook(c *Ctx) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(c.Data, "wl_book:"), 10, 64)
+	if err != nil {
+		return
+	}
+	e, ok, err := database.GetWaitlistEntry(c.DB, id)
+	if err != nil {
+		slog.Error("get waitlist entry error", "id", id, "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return
+	}
+	if !ok || e.StudentChatID != c.ChatID || e.OfferStartTS == 0 {
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "Это предложение больше не действует", nil)
+		return
+	}
+	if e.OfferExpiresTS <= time.Now().Unix() {
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "⌛ Бронь истекла, время предложено следующему в очереди", nil)
+		return
+	}
+
+	_, err = database.CreateAppointmentTx(c.DB, database.NewAppointment{
+		TeacherID:     e.TeacherID,
+		StudentChatID: c.ChatID,
+		StudentName:   e.StudentName,
+		StartTS:       e.OfferStartTS,
+		DurationMin:   e.DurationMin,
+	})
+	switch {
+	case err == database.ErrSlotBusy || err == database.ErrOutsideWorkingHours || err == database.ErrBlockedPeriod:
+		// время успели занять в обход очереди — ученик остаётся ждать дальше
+		if err := database.ClearWaitlistOffer(c.DB, e.ID); err != nil {
+			slog.Error("clear waitlist offer error", "id", e.ID, "err", err)
+		}
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "❌ Увы, это время уже занято. Вы остаётесь в листе ожидания.", nil)
+		return
+	case err != nil:
+		slog.Error("create appointment error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка записи в базу данных")
+		return
+	}
+
+	if err := database.DeleteWaitlistEntry(c.DB, e.ID); err != nil {
+		slog.Error("delete waitlist entry error", "id", e.ID, "err", err)
+	}
+	start := time.Unix(e.OfferStartTS, 0).In(time.FixedZone("Europe/Moscow", 3*3600))
+	_ = c.TG.EditMessageText(c.ChatID, c.MsgID, "✅ Вы записаны на "+start.Format("02.01.2006 15:04"), nil)
+	notifyTeacher(c.TG, c.DB, e.TeacherID, "📌 Новая запись (из листа ожидания)\n"+
+		"Ученик: "+e.StudentName+"\n"+
+		"Дата/время: "+start.Format("02.01.2006 15:04")+"\n"+
+		"Длительность: "+strconv.Itoa(e.DurationMin)+" мин")
+}
+
+// offerFreedSlot — занятие в startTS отменили или перенесли: его день мог кому-то подойти
+func offerFreedSlot(tg *telegram.Client, db *sql.DB, teacherID int64, startTS int64) {
+	date := time.Unix(startTS, 0).In(time.FixedZone("Europe/Moscow", 3*3600)).Format("2006-01-02")
+	offerWaitlist(tg, db, teacherID, date)
+}
+
+// offerWaitlist предлагает свободное время преподавателя teacherID на дату date
+// ожидающим по очереди. Время, уже предложенное кому-то, другим не предлагается.
+func offerWaitlist(tg *telegram.Client, db *sql.DB, teacherID int64, date string) {
+	waitlistMu.Lock()
+	defer waitlistMu.Unlock()
+
+	queue, err := database.GetDayWaitlist(db, teacherID, date)
+	if err != nil {
+		slog.Error("get waitlist error", "teacher_id", teacherID, "date", date, "err", err)
+		return
+	}
+	if len(queue) == 0 {
+		return
+	}
+
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return
+	}
+	now := time.Now().Unix()
+
+	// уже действующие предложения daySlots помечает занятыми сам;
+	// held — то, что предложено в этом проходе, после того как слоты прочитаны
+	type interval struct{ start, end int64 }
+	var held []interval
+
+	slotsByDur := make(map[int][]TimeSlot)
+	for _, e := range queue {
+		if e.OfferExpiresTS > now {
+			continue
+		}
+		slots, ok := slotsByDur[e.DurationMin]
+		if !ok {
+			slots, err = daySlots(db, teacherID, 0, date, e.DurationMin, 0)
+			if err != nil {
+				slog.Error("get day slots error", "date", date, "err", err)
+				return
+			}
+			slotsByDur[e.DurationMin] = slots
+		}
+
+		var startTS int64
+		for _, s := range slots {
+			if s.Busy || (e.StartMin != database.WaitAnyTime && s.Min != e.StartMin) {
+				continue
+			}
+			start := day.Add(time.Duration(s.Min) * time.Minute).Unix()
+			end := start + int64(e.DurationMin)*60
+			free := true
+			for _, h := range held {
+				if h.start < end && h.end > start {
+					free = false
+					break
+				}
+			}
+			if free {
+				startTS = start
+				break
+			}
+		}
+		if startTS == 0 {
+			continue
+		}
+
+		// бронь не дольше, чем до начала занятия
+		expires := time.Now().Add(waitlistOfferTTL).Unix()
+		if expires > startTS {
+			expires = startTS
+		}
+		offered, err := database.OfferWaitlistSlot(db, e.ID, startTS, expires)
+		if err != nil {
+			slog.Error("offer waitlist slot error", "id", e.ID, "err", err)
+			continue
+		}
+		if !offered {
+			continue
+		}
+		held = append(held, interval{startTS, startTS + int64(e.DurationMin)*60})
+
+		id := strconv.FormatInt(e.ID, 10)
+		kb := &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+			{Text: "✅ Забронировать", CallbackData: "wl_book:" + id},
+			{Text: "Не нужно", CallbackData: "wl_leave:" + id},
+		}}}
+		text := "🔔 Освободилось время: " + time.Unix(startTS, 0).In(loc).Format("02.01.2006 15:04") +
+			" (" + strconv.Itoa(e.DurationMin) + " мин)\n" +
+			"Бронь за вами до " + time.Unix(expires, 0).In(loc).Format("15:04") + ", потом время предложат следующему."
+		if err := tg.SendMessageInlineKeyboard(e.StudentChatID, text, kb); err != nil {
+			if markIfBlocked(db, e.StudentChatID, err) {
+				_ = database.DeleteWaitlistEntry(db, e.ID)
+				continue
+			}
+			slog.Error("send waitlist offer error", "chat_id", e.StudentChatID, "err", err)
+		}
+	}
+}
+
+// runWaitlist в фоне снимает просроченные предложения (время переходит к следующему
+// в очереди) и чистит ожидание на прошедшие дни
+func runWaitlist(tg *telegram.Client, db *sql.DB) {
+	ticker := time.NewTicker(waitlistPollInterval)
+	defer ticker.Stop()
+
+	for {
+		expireWaitlistOffers(tg, db)
+		<-ticker.C
+	}
+}
+
+func expireWaitlistOffers(tg *telegram.Client, db *sql.DB) {
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	now := time.Now().In(loc)
+
+	if err := database.DeletePastWaitlist(db, now.Format("2006-01-02")); err != nil {
+		slog.Error("delete past waitlist error", "err", err)
+	}
+
+	expired, err := database.GetExpiredWaitlistOffers(db, now.Unix())
+	if err != nil {
+		slog.Error("get expired waitlist offers error", "err", err)
+		return
+	}
+	for _, e := range expired {
+		// не ответил — из очереди выходит, иначе ему предлагали бы снова и снова
+		if err := database.DeleteWaitlistEntry(db, e.ID); err != nil {
+			slog.Error("delete waitlist entry error", "id", e.ID, "err", err)
+			continue
+		}
+		text := "⌛ Бронь на " + time.Unix(e.OfferStartTS, 0).In(loc).Format("02.01.2006 15:04") +
+			" истекла, вы вышли из листа ожидания."
+		if err := tg.SendMessage(e.StudentChatID, text); err != nil && !markIfBlocked(db, e.StudentChatID, err) {
+			slog.Error("send waitlist expiry error", "chat_id", e.StudentChatID, "err", err)
+		}
+		offerWaitlist(tg, db, e.TeacherID, e.Date)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bot/telegram"
+	"sync"
+	"testing"
+	"time"
+)
+
+func chatUpdate(chatID int64, updateID int64) telegram.Update {
+	return telegram.Update{
+		UpdateID:     updateID,
+		MyChatMember: &telegram.ChatMemberUpdated{Chat: telegram.Chat{ID: chatID}},
+	}
+}
+
+// обновления одного чата обрабатываются в порядке поступления
+func TestWorkerPoolPerChatOrder(t *testing.T) {
+	const chats, perChat = 10, 50 // не больше maxQueuedUpdates на очередь
+
+	var mu sync.Mutex
+	got := make(map[int64][]int64)
+	p := newWorkerPool(4, func(u telegram.Update) {
+		mu.Lock()
+		got[updateChatID(u)] = append(got[updateChatID(u)], u.UpdateID)
+		mu.Unlock()
+	})
+
+	for i := int64(0); i < perChat; i++ {
+		for chat := int64(1); chat <= chats; chat++ {
+			if !p.Submit(chatUpdate(chat, i)) {
+				t.Fatalf("update %d of chat %d dropped", i, chat)
+			}
+		}
+	}
+	p.Close()
+
+	for chat := int64(1); chat <= chats; chat++ {
+		ids := got[chat]
+		if len(ids) != perChat {
+			t.Fatalf("chat %d: handled %d updates, want %d", chat, len(ids), perChat)
+		}
+		for i, id := range ids {
+			if id != int64(i) {
+				t.Fatalf("chat %d: update %d handled at position %d", chat, id, i)
+			}
+		}
+	}
+}
+
+// пока один чат висит в обработчике, чаты других очередей обрабатываются,
+// а Submit не ждёт даже при переполненной очереди зависшего чата
+func TestWorkerPoolSlowChatDoesNotBlockOthers(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan int64, 10)
+	p := newWorkerPool(2, func(u telegram.Update) {
+		if updateChatID(u) == 2 { // очередь 0
+			close(started)
+			<-release
+		}
+		done <- updateChatID(u)
+	})
+
+	p.Submit(chatUpdate(2, 0))
+	<-started
+
+	submitted := make(chan int)
+	go func() {
+		accepted := 0
+		for i := 0; i < maxQueuedUpdates+10; i++ {
+			if p.Submit(chatUpdate(4, int64(i))) { // та же очередь 0
+				accepted++
+			}
+		}
+		p.Submit(chatUpdate(3, 0)) // очередь 1
+		submitted <- accepted
+	}()
+
+	select {
+	case accepted := <-submitted:
+		if accepted != maxQueuedUpdates {
+			t.Fatalf("accepted %d updates into a full queue, want %d", accepted, maxQueuedUpdates)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit blocked on a stalled queue")
+	}
+
+	select {
+	case chat := <-done:
+		if chat != 3 {
+			t.Fatalf("handled chat %d first, want 3", chat)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("chat 3 was not handled while chat 2 was stalled")
+	}
+
+	close(release)
+	go func() {
+		for range done {
+		}
+	}()
+	p.Close()
+	close(done)
+}
+
+// после Close обновления не принимаются, а принятые до него — обработаны
+func TestWorkerPoolClose(t *testing.T) {
+	var mu sync.Mutex
+	n := 0
+	p := newWorkerPool(3, func(u telegram.Update) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		n++
+		mu.Unlock()
+	})
+	for i := int64(0); i < 30; i++ {
+		p.Submit(chatUpdate(i, i))
+	}
+	p.Close()
+
+	if n != 30 {
+		t.Fatalf("handled %d updates before Close returned, want 30", n)
+	}
+	if p.Submit(chatUpdate(1, 100)) {
+		t.Fatal("Submit accepted an update after Close")
+	}
+}
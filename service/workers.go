@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bot/telegram"
+	"sync"
+)
+
+// Сколько обновлений обрабатывается параллельно (меняется через Config)
+const defaultWorkers = 8
+
+// Сколько обновлений может ждать в одной очереди. Больше — обновление отбрасывается:
+// диспетчер не должен вставать из-за одной зависшей очереди, иначе встанут все чаты.
+const maxQueuedUpdates = 256
+
+// workerPool обрабатывает обновления параллельно, но обновления одного чата —
+// строго по очереди: чат всегда попадает в одну и ту же очередь (chatID % N).
+// Медленный запрос к базе или Telegram задерживает только чаты своей очереди,
+// а Submit никогда не ждёт.
+type workerPool struct {
+	queues []*updateQueue
+	wg     sync.WaitGroup
+}
+
+// updateQueue — очередь одного воркера: срез под мьютексом и сигнал «есть работа»
+type updateQueue struct {
+	mu      sync.Mutex
+	pending []telegram.Update
+	closed  bool
+	wake    chan struct{} // буфер 1: воркер проснётся, сколько бы Submit ни пришло
+}
+
+func newWorkerPool(workers int, handle func(telegram.Update)) *workerPool {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	p := &workerPool{queues: make([]*updateQueue, workers)}
+	for i := range p.queues {
+		q := &updateQueue{wake: make(chan struct{}, 1)}
+		p.queues[i] = q
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				u, ok := q.next()
+				if !ok {
+					return
+				}
+				handle(u)
+			}
+		}()
+	}
+	return p
+}
+
+// next ждёт следующее обновление; false — очередь закрыта и пуста
+func (q *updateQueue) next() (telegram.Update, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			u := q.pending[0]
+			q.pending[0] = telegram.Update{}
+			q.pending = q.pending[1:]
+			q.mu.Unlock()
+			return u, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return telegram.Update{}, false
+		}
+		<-q.wake
+	}
+}
+
+func (q *updateQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Submit ставит обновление в очередь его чата и сразу возвращается.
+// false — очередь переполнена (в ней уже maxQueuedUpdates) или пул закрыт; обновление отброшено.
+func (p *workerPool) Submit(u telegram.Update) bool {
+	q := p.queues[uint64(updateChatID(u))%uint64(len(p.queues))]
+
+	q.mu.Lock()
+	if q.closed || len(q.pending) >= maxQueuedUpdates {
+		q.mu.Unlock()
+		return false
+	}
+	q.pending = append(q.pending, u)
+	q.mu.Unlock()
+	q.signal()
+	return true
+}
+
+// Close дожидается обработки всего, что уже поставлено в очереди
+func (p *workerPool) Close() {
+	for _, q := range p.queues {
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		q.signal()
+	}
+	p.wg.Wait()
+}
+
+// updateChatID — чат, к которому относится обновление (0, если непонятно)
+func updateChatID(u telegram.Update) int64 {
+	switch {
+	case u.Message != nil:
+		return u.Message.Chat.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil:
+		return u.CallbackQuery.Message.Chat.ID
+	case u.MyChatMember != nil:
+		return u.MyChatMember.Chat.ID
+	}
+	return 0
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bot/database"
+	"bot/telegram"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Дни недели в привычном порядке (с понедельника)
+var weekdaysOrder = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+}
+
+var weekdayShort = map[time.Weekday]string{
+	time.Monday:    "Пн",
+	time.Tuesday:   "Вт",
+	time.Wednesday: "Ср",
+	time.Thursday:  "Чт",
+	time.Friday:    "Пт",
+	time.Saturday:  "Сб",
+	time.Sunday:    "Вс",
+}
+
+// hoursLabel: "09:00–21:00" или "выходной"
+func hoursLabel(h database.WorkingHours) string {
+	if h.DayOff {
+		return "выходной"
+	}
+	return clockLabel(h.StartMin) + "–" + clockLabel(h.EndMin)
+}
+
+func clockLabel(min int) string {
+	return fmt.Sprintf("%02d:%02d", min/60, min%60)
+}
+
+func workingHoursText(week [7]database.WorkingHours, exceptions []database.WorkingHoursException) string {
+	var b strings.Builder
+	b.WriteString("🕘 Рабочее время\n")
+	for _, wd := range weekdaysOrder {
+		b.WriteString("\n" + weekdayShort[wd] + ": " + hoursLabel(week[wd]))
+	}
+	if len(exceptions) > 0 {
+		b.WriteString("\n\nИсключения:")
+		for _, e := range exceptions {
+			b.WriteString("\n" + exceptionDateLabel(e.Date) + ": " + hoursLabel(e.WorkingHours))
+		}
+	}
+	b.WriteString("\n\nНажмите на день, чтобы изменить часы.")
+	return b.String()
+}
+
+func exceptionDateLabel(date string) string {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return d.Format("02.01.2006") + " (" + weekdayShort[d.Weekday()] + ")"
+}
+
+// WorkingHoursKeyboard: wh:day:<weekday>, wh:exc:add, wh:exc:del:<YYYY-MM-DD>
+func WorkingHoursKeyboard(week [7]database.WorkingHours, exceptions []database.WorkingHoursException) *telegram.InlineKeyboardMarkup {
+	var rows [][]telegram.InlineKeyboardButton
+	var row []telegram.InlineKeyboardButton
+	for _, wd := range weekdaysOrder {
+		row = append(row, telegram.InlineKeyboardButton{
+			Text:         weekdayShort[wd] + " " + hoursLabel(week[wd]),
+			CallbackData: "wh:day:" + strconv.Itoa(int(wd)),
+		})
+		// 2 колонки
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	for _, e := range exceptions {
+		rows = append(rows, []telegram.InlineKeyboardButton{{
+			Text:         "❌ " + exceptionDateLabel(e.Date) + " " + hoursLabel(e.WorkingHours),
+			CallbackData: "wh:exc:del:" + e.Date,
+		}})
+	}
+	rows = append(rows, []telegram.InlineKeyboardButton{
+		{Text: "➕ Исключение на дату", CallbackData: "wh:exc:add"},
+	})
+
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// loadWorkingHours читает шаблон и будущие исключения вошедшего преподавателя
+func loadWorkingHours(c *Ctx) ([7]database.WorkingHours, []database.WorkingHoursException, bool) {
+	week, err := database.GetWeeklyHours(c.DB, currentTeacherID(c.ChatID))
+	if err != nil {
+		slog.Error("get working hours error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return week, nil, false
+	}
+	today := time.Now().In(time.FixedZone("Europe/Moscow", 3*3600)).Format("2006-01-02")
+	exceptions, err := database.GetWorkingHoursExceptions(c.DB, currentTeacherID(c.ChatID), today)
+	if err != nil {
+		slog.Error("get working hours exceptions error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка чтения базы данных")
+		return week, nil, false
+	}
+	return week, exceptions, true
+}
+
+// «Рабочее время» — меню преподавателя
+func handleWorkingHours(c *Ctx) {
+	week, exceptions, ok := loadWorkingHours(c)
+	if !ok {
+		return
+	}
+	_ = c.TG.SendMessageInlineKeyboard(c.ChatID, workingHoursText(week, exceptions), WorkingHoursKeyboard(week, exceptions))
+}
+
+// wh:day:<weekday> / wh:exc:add / wh:exc:del:<date>
+func handleWorkingHoursCallback(c *Ctx) {
+	parts := strings.Split(c.Data, ":")
+	switch {
+	case len(parts) == 3 && parts[1] == "day":
+		wd, err := strconv.Atoi(parts[2])
+		if err != nil || wd < 0 || wd > 6 {
+			return
+		}
+		c.Sess.TeacherStatus = "wh_day"
+		c.Sess.WorkingDay = wd
+		_ = c.TG.SendMessage(c.ChatID, "Часы для «"+weekdayShort[time.Weekday(wd)]+"»: введите, например, 10:00-18:00 или «выходной».")
+
+	case len(parts) == 3 && parts[1] == "exc" && parts[2] == "add":
+		c.Sess.TeacherStatus = "wh_exception"
+		_ = c.TG.SendMessage(c.ChatID, "Введите дату и часы, например:\n31.12.2026 10:00-14:00\n31.12.2026 выходной")
+
+	case len(parts) == 4 && parts[1] == "exc" && parts[2] == "del":
+		if err := database.DeleteWorkingHoursException(c.DB, currentTeacherID(c.ChatID), parts[3]); err != nil {
+			_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+			return
+		}
+		// обновляем то же меню, а не присылаем новое
+		week, exceptions, ok := loadWorkingHours(c)
+		if !ok {
+			return
+		}
+		_ = c.TG.EditMessageText(c.ChatID, c.MsgID, workingHoursText(week, exceptions), WorkingHoursKeyboard(week, exceptions))
+	}
+}
+
+// шаг wh_day: часы для дня недели
+func handleWorkingDayInput(c *Ctx) {
+	h, ok := parseWorkingHours(c.Text)
+	if !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Не понял. Пример: 10:00-18:00 или «выходной» (минуты только 00 или 30)")
+		return
+	}
+
+	if err := database.SetWeeklyHours(c.DB, currentTeacherID(c.ChatID), time.Weekday(c.Sess.WorkingDay), h); err != nil {
+		slog.Error("save working hours error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+		return
+	}
+	c.Sess.TeacherStatus = ""
+	c.Sess.WorkingDay = 0
+	handleWorkingHours(c)
+}
+
+// шаг wh_exception: "31.12.2026 10:00-14:00" / "31.12.2026 выходной"
+func handleWorkingExceptionInput(c *Ctx) {
+	dateStr, hoursStr, _ := strings.Cut(strings.TrimSpace(c.Text), " ")
+
+	loc := time.FixedZone("Europe/Moscow", 3*3600)
+	day, err := time.ParseInLocation("02.01.2006", dateStr, loc)
+	h, ok := parseWorkingHours(hoursStr)
+	if err != nil || !ok {
+		_ = c.TG.SendMessage(c.ChatID, "Не понял. Пример: 31.12.2026 10:00-14:00 или 31.12.2026 выходной")
+		return
+	}
+	now := time.Now().In(loc)
+	if day.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)) {
+		_ = c.TG.SendMessage(c.ChatID, "Эта дата уже прошла")
+		return
+	}
+
+	if err := database.SetWorkingHoursException(c.DB, currentTeacherID(c.ChatID), day.Format("2006-01-02"), h); err != nil {
+		slog.Error("save working hours exception error", "err", err)
+		_ = c.TG.SendMessage(c.ChatID, "Ошибка сохранения в базе данных. Попробуйте ещё раз.")
+		return
+	}
+	c.Sess.TeacherStatus = ""
+	handleWorkingHours(c)
+}
+
+// parseWorkingHours: "10:00-18:00", "9-18", "9.30 — 18", "выходной"
+func parseWorkingHours(s string) (database.WorkingHours, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "выходной" {
+		return database.WorkingHours{DayOff: true}, true
+	}
+
+	s = strings.NewReplacer("—", "-", "–", "-", " ", "").Replace(s)
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return database.WorkingHours{}, false
+	}
+	start, ok1 := parseClock(from)
+	end, ok2 := parseClock(to)
+	if !ok1 || !ok2 || start >= end {
+		return database.WorkingHours{}, false
+	}
+	return database.WorkingHours{StartMin: start, EndMin: end}, true
+}
+
+// parseClock: "9" / "9:30" / "09.30" / "24:00" -> минуты от полуночи (шаг 30 минут)
+func parseClock(s string) (int, bool) {
+	hStr, mStr, hasMin := strings.Cut(strings.ReplaceAll(s, ".", ":"), ":")
+	h, err := strconv.Atoi(hStr)
+	if err != nil {
+		return 0, false
+	}
+	m := 0
+	if hasMin {
+		if m, err = strconv.Atoi(mStr); err != nil {
+			return 0, false
+		}
+	}
+	if m != 0 && m != 30 {
+		return 0, false
+	}
+	min := h*60 + m
+	if h < 0 || min > 24*60 {
+		return 0, false
+	}
+	return min, true
+}
@@ -0,0 +1,102 @@
+package telegram
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL — адрес публичного Bot API
+const DefaultBaseURL = "https://api.telegram.org"
+
+// Client — клиент Bot API. Все методы отправки висят на нём,
+// поэтому токен не нужно таскать по коду отдельной строкой.
+type Client struct {
+	// Токен бота
+	Token string
+
+	// Адрес Bot API без завершающего "/".
+	// Можно указать свой Bot API сервер или локальную заглушку.
+	// Значение по умолчанию - DefaultBaseURL
+	BaseURL string
+
+	// HTTP-клиент, через который идут все запросы
+	HTTPClient *http.Client
+
+	// Таймаут обычного запроса к API
+	RequestTimeout time.Duration
+
+	// Сколько секунд Telegram держит getUpdates открытым (long polling).
+	// Итоговый таймаут запроса getUpdates = PollTimeout + RequestTimeout
+	PollTimeout time.Duration
+
+	// Сколько раз повторять запрос после 429, 5xx или сетевой ошибки
+	MaxRetries int
+
+	// Лимиты на исходящие сообщения. Менять до первого запроса
+	RateLimits RateLimits
+
+	// Сколько самое большее ждать retry_after после 429. Если Telegram просит дольше,
+	// запрос не повторяется и возвращается ошибка: обработчик чата не висит минутами.
+	// 0 — без ограничения
+	MaxWait time.Duration
+
+	limiterOnce sync.Once
+	rl          *rateLimiter
+}
+
+// NewClient создаёт клиент с настройками по умолчанию
+func NewClient(token string) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+
+	return &Client{
+		Token:          token,
+		BaseURL:        DefaultBaseURL,
+		HTTPClient:     &http.Client{Transport: transport},
+		RequestTimeout: 15 * time.Second,
+		PollTimeout:    10 * time.Second,
+		MaxRetries:     3,
+		RateLimits:     DefaultRateLimits,
+		MaxWait:        5 * time.Second,
+	}
+}
+
+func (c *Client) limiter() *rateLimiter {
+	c.limiterOnce.Do(func() {
+		c.rl = newRateLimiter(c.RateLimits)
+	})
+	return c.rl
+}
+
+// methodURL — полный адрес метода: <BaseURL>/bot<token>/<method>
+func (c *Client) methodURL(method string) string {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	return strings.TrimRight(base, "/") + "/bot" + c.Token + "/" + method
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// requestContext — контекст с таймаутом на один запрос (плюс extra для long polling)
+func (c *Client) requestContext(extra time.Duration) (context.Context, context.CancelFunc) {
+	timeout := c.RequestTimeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	return context.WithTimeout(context.Background(), timeout+extra)
+}
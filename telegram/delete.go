@@ -7,11 +7,11 @@ type deleteMessageResp struct {
 	Result bool `json:"result"`
 }
 
-func DeleteMessage(token string, chatID int64, messageID int) error {
+func (c *Client) DeleteMessage(chatID int64, messageID int) error {
 	params := map[string]string{
 		"chat_id":    strconv.FormatInt(chatID, 10),
 		"message_id": strconv.Itoa(messageID),
 	}
 	var resp deleteMessageResp
-	return CallTelegramAPIGet(token, "deleteMessage", params, &resp)
+	return c.CallAPIGet("deleteMessage", params, &resp)
 }
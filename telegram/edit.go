@@ -0,0 +1,46 @@
+package telegram
+
+import "fmt"
+
+// EditMessageText заменяет текст и inline-клавиатуру сообщения.
+// Если kb == nil, клавиатура у сообщения убирается.
+func (c *Client) EditMessageText(chatID int64, messageID int, text string, kb *InlineKeyboardMarkup) error {
+	payload := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}
+	if kb != nil {
+		payload["reply_markup"] = kb
+	}
+	return c.callEdit("editMessageText", payload)
+}
+
+// EditMessageReplyMarkup заменяет только inline-клавиатуру сообщения.
+// Если kb == nil, клавиатура убирается.
+func (c *Client) EditMessageReplyMarkup(chatID int64, messageID int, kb *InlineKeyboardMarkup) error {
+	payload := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}
+	if kb != nil {
+		payload["reply_markup"] = kb
+	}
+	return c.callEdit("editMessageReplyMarkup", payload)
+}
+
+func (c *Client) callEdit(method string, payload map[string]interface{}) error {
+	var resp SendMessageResponse
+	err := c.CallAPIPostJSON(method, payload, &resp)
+	// повторное нажатие той же кнопки — сообщение уже в нужном виде, это не ошибка
+	if IsMessageNotModified(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("telegram %s not ok", method)
+	}
+	return nil
+}
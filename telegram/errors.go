@@ -0,0 +1,77 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrRateLimited — чат на паузе после 429 дольше, чем Client.MaxWait; запрос не отправлялся
+var ErrRateLimited = errors.New("telegram: chat is rate limited")
+
+// APIError — ошибка, которую вернул Bot API (ok=false)
+type APIError struct {
+	// error_code из ответа (если его нет — HTTP-статус)
+	Code int
+
+	Description string
+
+	Parameters ResponseParameters
+}
+
+// ResponseParameters — подсказки Telegram, как повторить запрос
+type ResponseParameters struct {
+	// Группа стала супергруппой — писать нужно в этот chat_id
+	MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+
+	// Сколько секунд подождать перед повтором (при 429)
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram API error %d: %s", e.Code, e.Description)
+}
+
+// newAPIError разбирает тело ответа с ошибкой; если это не JSON — кладёт тело в Description
+func newAPIError(status int, body []byte) *APIError {
+	var resp apiResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Description == "" {
+		return &APIError{Code: status, Description: strings.TrimSpace(string(body))}
+	}
+
+	e := &APIError{Code: resp.ErrorCode, Description: resp.Description}
+	if e.Code == 0 {
+		e.Code = status
+	}
+	if resp.Parameters != nil {
+		e.Parameters = *resp.Parameters
+	}
+	return e
+}
+
+// IsNotSent — сообщение точно не ушло: запрос не дошёл до Telegram, чат на паузе после 429
+// или Bot API ответил ошибкой. Иначе (например, таймаут после отправки) оно могло дойти.
+func IsNotSent(err error) bool {
+	var apiErr *APIError
+	return errors.Is(err, ErrRateLimited) || errors.As(err, &apiErr) || notSent(err)
+}
+
+// IsBlockedByUser — пользователь заблокировал бота (или удалил аккаунт),
+// писать ему больше нельзя
+func IsBlockedByUser(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 403 {
+		return false
+	}
+	d := strings.ToLower(apiErr.Description)
+	return strings.Contains(d, "bot was blocked by the user") ||
+		strings.Contains(d, "user is deactivated")
+}
+
+// IsMessageNotModified — правка не изменила сообщение (например, повторное нажатие той же кнопки)
+func IsMessageNotModified(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == 400 &&
+		strings.Contains(apiErr.Description, "message is not modified")
+}
@@ -0,0 +1,191 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimits — ограничения на исходящие сообщения.
+// Telegram режет ботов примерно на 30 сообщениях в секунду всего,
+// 1 сообщении в секунду в один чат и 20 в минуту в одну группу.
+// Лимит на чат касается только новых сообщений (countsAsMessage),
+// общий — всех запросов с chat_id.
+type RateLimits struct {
+	// Сообщений в секунду по всем чатам. 0 — без ограничения
+	GlobalPerSecond float64
+
+	// Сообщений в секунду в один личный чат. 0 — без ограничения
+	PerChatPerSecond float64
+
+	// Сообщений в минуту в одну группу (chat_id < 0). 0 — без ограничения
+	PerGroupPerMinute float64
+
+	// Сколько сообщений в один чат можно отправить пачкой без ожидания
+	ChatBurst float64
+}
+
+// DefaultRateLimits — лимиты по документации Bot API
+var DefaultRateLimits = RateLimits{
+	GlobalPerSecond:   30,
+	PerChatPerSecond:  1,
+	PerGroupPerMinute: 20,
+	ChatBurst:         3,
+}
+
+// bucket — token bucket, который может уйти в минус: так каждая отправка
+// бронирует себе место в очереди, и отправки выходят по порядку.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// reserve забирает один токен и возвращает, сколько нужно подождать
+func (b *bucket) reserve(now time.Time, rate, burst float64) time.Duration {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// rateLimiter — очередь отправок с общим лимитом и лимитом на чат
+type rateLimiter struct {
+	limits RateLimits
+
+	mu          sync.Mutex
+	global      bucket
+	chats       map[int64]*bucket
+	pausedUntil map[int64]time.Time // после 429 retry_after — только для чата, получившего 429
+	lastCleanup time.Time
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	return &rateLimiter{
+		limits:      limits,
+		chats:       make(map[int64]*bucket),
+		pausedUntil: make(map[int64]time.Time),
+	}
+}
+
+// countsAsMessage — метод шлёт в чат новое сообщение и попадает под лимит на чат.
+// Правки, удаления и ответы на нажатия в него не входят: иначе кнопки листаются
+// по секунде на нажатие.
+func countsAsMessage(method string) bool {
+	return !strings.HasPrefix(method, "edit") && !strings.HasPrefix(method, "delete") &&
+		method != "answerCallbackQuery"
+}
+
+// wait блокирует, пока не подойдёт очередь запроса в chatID; perChat — учитывать лимит на чат.
+// Если чат на паузе после 429 дольше maxWait (0 — без ограничения), сразу ErrRateLimited:
+// ждать минуту значит держать воркер и все чаты его очереди.
+func (l *rateLimiter) wait(ctx context.Context, chatID int64, perChat bool, maxWait time.Duration) error {
+	d, ok := l.reserve(chatID, perChat, maxWait)
+	if !ok {
+		return ErrRateLimited
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve занимает место в очереди и возвращает, сколько ждать.
+// false — чат на паузе дольше maxWait; тогда место не занимается.
+func (l *rateLimiter) reserve(chatID int64, perChat bool, maxWait time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.cleanup(now)
+
+	// пауза после 429
+	var d time.Duration
+	if until, ok := l.pausedUntil[chatID]; ok {
+		d = until.Sub(now)
+		if maxWait > 0 && d > maxWait {
+			return 0, false
+		}
+	}
+	if l.limits.GlobalPerSecond > 0 {
+		burst := l.limits.GlobalPerSecond
+		if gd := l.global.reserve(now, l.limits.GlobalPerSecond, burst); gd > d {
+			d = gd
+		}
+	}
+
+	if perChat && chatID != 0 {
+		rate := l.limits.PerChatPerSecond
+		if chatID < 0 {
+			rate = l.limits.PerGroupPerMinute / 60
+		}
+		if rate > 0 {
+			burst := l.limits.ChatBurst
+			if burst < 1 {
+				burst = 1
+			}
+			b, ok := l.chats[chatID]
+			if !ok {
+				b = &bucket{}
+				l.chats[chatID] = b
+			}
+			if cd := b.reserve(now, rate, burst); cd > d {
+				d = cd
+			}
+		}
+	}
+	return d, true
+}
+
+// pause запрещает запросы в chatID на d — так просит Telegram в retry_after.
+// 429 без chat_id (например, на answerCallbackQuery) другие чаты не останавливает.
+func (l *rateLimiter) pause(chatID int64, d time.Duration) {
+	if chatID == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil[chatID]) {
+		l.pausedUntil[chatID] = until
+	}
+}
+
+// cleanup раз в минуту выкидывает чаты, по которым давно ничего не отправляли
+func (l *rateLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < time.Minute {
+		return
+	}
+	l.lastCleanup = now
+
+	for id, b := range l.chats {
+		if now.Sub(b.last) > time.Minute {
+			delete(l.chats, id)
+		}
+	}
+	for id, until := range l.pausedUntil {
+		if now.After(until) {
+			delete(l.pausedUntil, id)
+		}
+	}
+}
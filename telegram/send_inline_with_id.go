@@ -12,9 +12,9 @@ type sendMessageInlineRespID struct {
 	} `json:"result"`
 }
 
-// Если у тебя уже есть SendMessageInlineKeyboard — можешь оставить его,
-// но для удаления нам нужен message_id, поэтому делаем версию с возвратом ID.
-func SendMessageInlineKeyboardReturnID(token string, chatID int64, text string, kb *InlineKeyboardMarkup) (int, error) {
+// SendMessageInlineKeyboardReturnID — как SendMessageInlineKeyboard, но возвращает message_id
+// отправленного сообщения, чтобы потом его редактировать или удалять.
+func (c *Client) SendMessageInlineKeyboardReturnID(chatID int64, text string, kb *InlineKeyboardMarkup) (int, error) {
 	// Telegram требует reply_markup как JSON-строку
 	rm, _ := json.Marshal(kb)
 
@@ -25,9 +25,7 @@ func SendMessageInlineKeyboardReturnID(token string, chatID int64, text string,
 	}
 
 	var resp sendMessageInlineRespID
-	// если твой CallTelegramAPIGet принимает map — ок.
-	// Если Telegram у тебя отправляется POST — скажи, я подстрою под твой helper.
-	if err := CallTelegramAPIGet(token, "sendMessage", params, &resp); err != nil {
+	if err := c.CallAPIGet("sendMessage", params, &resp); err != nil {
 		return 0, err
 	}
 	return resp.Result.MessageID, nil
@@ -2,99 +2,220 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func CallTelegramAPIGet(token string, method string, params map[string]string, result interface{}) error {
-	botToken := fmt.Sprintf("bot%s", token)
-	baseURL := &url.URL{
-		Scheme: "https",
-		Host:   "api.telegram.org",
-	}
+func (c *Client) CallAPIGet(method string, params map[string]string, result interface{}) error {
+	return c.callAPIGet(method, params, result, 0)
+}
 
-	baseURL = baseURL.JoinPath(botToken, method)
+func (c *Client) callAPIGet(method string, params map[string]string, result interface{}, extraTimeout time.Duration) error {
+	apiURL, err := url.Parse(c.methodURL(method))
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
 
-	q := baseURL.Query()
+	q := apiURL.Query()
 	for key, value := range params {
 		q.Set(key, value)
 	}
-	baseURL.RawQuery = q.Encode()
+	apiURL.RawQuery = q.Encode()
+
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	return c.do(method, chatID, extraTimeout, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, apiURL.String(), nil)
+	}, result)
+}
 
-	resp, err := http.Get(baseURL.String())
+func (c *Client) CallAPIPostJSON(method string, payload interface{}, result interface{}) error {
+	jsonBody, err := json.Marshal(payload)
 	if err != nil {
-		return err //ошибка при запросе
+		return fmt.Errorf("error: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return errors.New("telegram returned error: " + string(body)) //ошибка от Telegram
-	}
+	return c.do(method, payloadChatID(payload), 0, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL(method), bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, result)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("read body error: %w", err) //ошибка чтения тела ответа
-	}
+// do выполняет запрос к API:
+// - отправки в чат (chatID != 0) ждут своей очереди по лимитам RateLimits;
+// - на 429 ставит чат на паузу retry_after и повторяет (если ждать не дольше MaxWait);
+// - на 5xx повторяет с нарастающей паузой (не больше MaxRetries раз);
+// - сетевую ошибку повторяет, только если запрос не ушёл или повтор безопасен.
+//
+// sendMessage, дошедший до Telegram, но оставшийся без ответа (таймаут), не повторяется:
+// иначе сообщение пришло бы дважды.
+func (c *Client) do(method string, chatID int64, extraTimeout time.Duration, newRequest func(ctx context.Context) (*http.Request, error), result interface{}) error {
+	backoff := 500 * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		if chatID != 0 {
+			ctx, cancel := c.requestContext(time.Minute)
+			err := c.limiter().wait(ctx, chatID, countsAsMessage(method), c.MaxWait)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+		}
 
-	if err := json.Unmarshal(body, result); err != nil {
-		return fmt.Errorf("json unmarshal error: %w", err) //ошибка разбора JSON
+		status, body, err := c.roundTrip(extraTimeout, newRequest)
+		if err == nil && status == http.StatusOK {
+			if result != nil {
+				if err := json.Unmarshal(body, result); err != nil {
+					return fmt.Errorf("json unmarshal error: %w", err) //ошибка разбора JSON
+				}
+			}
+			return nil
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			// сетевая ошибка / таймаут
+			retry := notSent(err) || idempotentMethod(method)
+			err = fmt.Errorf("error: %w", err)
+			if !retry {
+				return err
+			}
+			wait = backoff
+		case status == http.StatusTooManyRequests:
+			apiErr := newAPIError(status, body)
+			err = apiErr
+			wait = time.Second
+			if apiErr.Parameters.RetryAfter > 0 {
+				wait = time.Duration(apiErr.Parameters.RetryAfter) * time.Second
+			}
+			c.limiter().pause(chatID, wait)
+			if c.MaxWait > 0 && wait > c.MaxWait {
+				// не держим воркер: сообщение не уйдёт, вызывающий получит 429
+				return err
+			}
+		case status >= 500:
+			err = newAPIError(status, body)
+			wait = backoff
+		default:
+			// 400/403/404... — повтор не поможет
+			return newAPIError(status, body)
+		}
+
+		if attempt >= c.MaxRetries {
+			return err
+		}
+		time.Sleep(wait)
+		if backoff < 8*time.Second {
+			backoff *= 2
+		}
 	}
+}
 
-	return nil
+// idempotentMethod — повтор метода ничего не задвоит: чтение, правка, удаление, ответ на нажатие
+func idempotentMethod(method string) bool {
+	for _, prefix := range []string{"get", "edit", "delete", "set"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return method == "answerCallbackQuery"
 }
 
-func CallTelegramAPIPostJSON(token string, method string, payload interface{}, result interface{}) error {
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/%s", token, method)
-	jsonBody, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("error: %w", err)
+// notSent — запрос не дошёл до Telegram: не удалось найти адрес или подключиться
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
 	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// roundTrip — один HTTP-запрос; возвращает статус и тело ответа
+func (c *Client) roundTrip(extraTimeout time.Duration, newRequest func(ctx context.Context) (*http.Request, error)) (int, []byte, error) {
+	ctx, cancel := c.requestContext(extraTimeout)
+	defer cancel()
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonBody))
+	req, err := newRequest(ctx)
 	if err != nil {
-		return fmt.Errorf("error: %w", err)
+		return 0, nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		return fmt.Errorf("error: %w", err)
+		return 0, nil, err //ошибка при запросе
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("telegram API status %d: %s", resp.StatusCode, string(body))
-	}
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error: %w", err)
+		return 0, nil, fmt.Errorf("read body error: %w", err) //ошибка чтения тела ответа
 	}
+	return resp.StatusCode, body, nil
+}
 
-	if result != nil {
-		if err := json.Unmarshal(body, result); err != nil {
-			return fmt.Errorf("error: %w", err)
+// apiResponse — общая часть любого ответа Bot API
+type apiResponse struct {
+	Ok          bool                `json:"ok"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
+}
+
+// payloadChatID достаёт chat_id из тела запроса — по нему считается лимит на чат
+func payloadChatID(payload interface{}) int64 {
+	switch p := payload.(type) {
+	case map[string]interface{}:
+		switch id := p["chat_id"].(type) {
+		case int64:
+			return id
+		case int:
+			return int64(id)
 		}
+	case map[string]string:
+		id, _ := strconv.ParseInt(p["chat_id"], 10, 64)
+		return id
+	}
+	return 0
+}
+
+// GetUpdates — long polling: ждёт новые обновления не дольше PollTimeout
+func (c *Client) GetUpdates(offset int64) ([]Update, error) {
+	params := map[string]string{
+		"timeout": strconv.Itoa(int(c.PollTimeout / time.Second)),
+	}
+	if offset > 0 {
+		params["offset"] = strconv.FormatInt(offset, 10)
 	}
 
-	return nil
+	var resp GetUpdatesResponse
+	if err := c.callAPIGet("getUpdates", params, &resp, c.PollTimeout); err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
 }
 
-func SendMessage(token string, chatID int64, text string) error {
+func (c *Client) SendMessage(chatID int64, text string) error {
 	payload := map[string]interface{}{
 		"chat_id": chatID,
 		"text":    text,
 	}
 
 	var resp SendMessageResponse
-	if err := CallTelegramAPIPostJSON(token, "sendMessage", payload, &resp); err != nil {
+	if err := c.CallAPIPostJSON("sendMessage", payload, &resp); err != nil {
 		return err
 	}
 	if !resp.Ok {
@@ -104,7 +225,7 @@ func SendMessage(token string, chatID int64, text string) error {
 	return nil
 }
 
-func SendMessageKeyboard(token string, chatID int64, text string, keyboard *ReplyKeyboardMarkup) error {
+func (c *Client) SendMessageKeyboard(chatID int64, text string, keyboard *ReplyKeyboardMarkup) error {
 	payload := map[string]interface{}{
 		"chat_id": chatID,
 		"text":    text,
@@ -115,7 +236,7 @@ func SendMessageKeyboard(token string, chatID int64, text string, keyboard *Repl
 	}
 
 	var resp SendMessageResponse
-	if err := CallTelegramAPIPostJSON(token, "sendMessage", payload, &resp); err != nil {
+	if err := c.CallAPIPostJSON("sendMessage", payload, &resp); err != nil {
 		return err
 	}
 	if !resp.Ok {
@@ -125,7 +246,7 @@ func SendMessageKeyboard(token string, chatID int64, text string, keyboard *Repl
 	return nil
 }
 
-func SendMessageInlineKeyboard(token string, chatID int64, text string, keyboard *InlineKeyboardMarkup) error {
+func (c *Client) SendMessageInlineKeyboard(chatID int64, text string, keyboard *InlineKeyboardMarkup) error {
 	payload := map[string]interface{}{
 		"chat_id": chatID,
 		"text":    text,
@@ -135,7 +256,7 @@ func SendMessageInlineKeyboard(token string, chatID int64, text string, keyboard
 	}
 
 	var resp SendMessageResponse
-	if err := CallTelegramAPIPostJSON(token, "sendMessage", payload, &resp); err != nil {
+	if err := c.CallAPIPostJSON("sendMessage", payload, &resp); err != nil {
 		return err
 	}
 	if !resp.Ok {
@@ -144,21 +265,9 @@ func SendMessageInlineKeyboard(token string, chatID int64, text string, keyboard
 	return nil
 }
 
-func AnswerCallbackQuery(token, callbackQueryID string) error {
+func (c *Client) AnswerCallbackQuery(callbackQueryID string) error {
 	payload := map[string]interface{}{
 		"callback_query_id": callbackQueryID,
 	}
-	return CallTelegramAPIPostJSON(token, "answerCallbackQuery", payload, nil)
+	return c.CallAPIPostJSON("answerCallbackQuery", payload, nil)
 }
-
-//func SendMessageReturnID(token string, chatID int64, text string) (int, error) {
-//	params := map[string]string{
-//		"chat_id": strconv.FormatInt(chatID, 10),
-//		"text":    text,
-//	}
-//	var resp SendMessageResponse
-//	if err := CallTelegramAPIGet(token, "sendMessage", params, &resp); err != nil {
-//		return 0, err
-//	}
-//	return resp.Result.MessageID, nil
-//}
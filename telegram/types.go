@@ -23,9 +23,24 @@ type message struct {
 }
 
 type Update struct {
-	UpdateID      int64          `json:"update_id"`
-	Message       *message       `json:"message,omitempty"`
-	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+	UpdateID      int64              `json:"update_id"`
+	Message       *message           `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery     `json:"callback_query,omitempty"`
+	MyChatMember  *ChatMemberUpdated `json:"my_chat_member,omitempty"`
+}
+
+// ChatMemberUpdated приходит, когда меняется статус самого бота в чате:
+// например, пользователь заблокировал бота ("kicked") или разблокировал ("member")
+type ChatMemberUpdated struct {
+	Chat          Chat       `json:"chat"`
+	From          User       `json:"from"`
+	Date          int64      `json:"date"`
+	NewChatMember ChatMember `json:"new_chat_member"`
+}
+
+type ChatMember struct {
+	Status string `json:"status"`
+	User   User   `json:"user"`
 }
 
 type GetUpdatesResponse struct {
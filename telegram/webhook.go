@@ -0,0 +1,157 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// SecretTokenHeader — заголовок, в котором Telegram присылает secret_token из setWebhook
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// SetWebhookParams — параметры метода setWebhook
+type SetWebhookParams struct {
+	// HTTPS-адрес, на который Telegram будет присылать обновления
+	URL string
+
+	// Секрет, который Telegram кладёт в заголовок X-Telegram-Bot-Api-Secret-Token.
+	// 1-256 символов: A-Z, a-z, 0-9, _ и -
+	SecretToken string
+
+	// Путь к публичному сертификату (PEM) — нужен только для самоподписанного сертификата
+	CertificateFile string
+
+	// Сбросить обновления, накопившиеся до установки webhook
+	DropPendingUpdates bool
+}
+
+type apiBoolResp struct {
+	Ok          bool   `json:"ok"`
+	Result      bool   `json:"result"`
+	Description string `json:"description,omitempty"`
+}
+
+func (c *Client) SetWebhook(p SetWebhookParams) error {
+	fields := map[string]string{
+		"url": p.URL,
+	}
+	if p.SecretToken != "" {
+		fields["secret_token"] = p.SecretToken
+	}
+	if p.DropPendingUpdates {
+		fields["drop_pending_updates"] = "true"
+	}
+
+	var resp apiBoolResp
+	var err error
+	if p.CertificateFile != "" {
+		// самоподписанный сертификат загружается файлом — только multipart/form-data
+		err = c.CallAPIPostMultipart("setWebhook", fields, "certificate", p.CertificateFile, &resp)
+	} else {
+		err = c.CallAPIPostJSON("setWebhook", fields, &resp)
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("telegram setWebhook not ok: %s", resp.Description)
+	}
+	return nil
+}
+
+func (c *Client) DeleteWebhook(dropPendingUpdates bool) error {
+	payload := map[string]interface{}{
+		"drop_pending_updates": dropPendingUpdates,
+	}
+
+	var resp apiBoolResp
+	if err := c.CallAPIPostJSON("deleteWebhook", payload, &resp); err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("telegram deleteWebhook not ok: %s", resp.Description)
+	}
+	return nil
+}
+
+// CallAPIPostMultipart отправляет поля и один файл как multipart/form-data
+func (c *Client) CallAPIPostMultipart(method string, fields map[string]string, fileField string, filePath string, result interface{}) error {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for key, value := range fields {
+		if err := w.WriteField(key, value); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	defer f.Close()
+
+	part, err := w.CreateFormFile(fileField, filepath.Base(filePath))
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+
+	return c.do(method, 0, 0, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL(method), bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req, nil
+	}, result)
+}
+
+// WebhookHandler принимает обновления от Telegram и передаёт их в канал updates.
+// Если secretToken не пустой, запросы без верного X-Telegram-Bot-Api-Secret-Token отклоняются.
+func WebhookHandler(secretToken string, updates chan<- Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if secretToken != "" {
+			got := r.Header.Get(SecretTokenHeader)
+			if subtle.ConstantTimeCompare([]byte(got), []byte(secretToken)) != 1 {
+				slog.Warn("webhook: bad secret token", "remote", r.RemoteAddr)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		var update Update
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&update); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// ждём, пока обработчик примет обновление; если запрос оборвался —
+		// отвечаем ошибкой, и Telegram пришлёт обновление повторно
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			http.Error(w, "timeout", http.StatusServiceUnavailable)
+		}
+	})
+}